@@ -4,11 +4,12 @@ import (
 	"api-gateway-log-parser/pkg/apigateway"
 	"context"
 	"errors"
+	"flag"
 	"os"
 )
 
 type ExportByConsumerHandler struct {
-	service apigateway.LogService
+	exporter
 }
 
 var (
@@ -16,8 +17,8 @@ var (
 	ErrConsumerParameterCouldNotBeEmpty = errors.New("service parameter could not be empty")
 )
 
-func NewExportByConsumerHandler(service apigateway.LogService) *ExportByConsumerHandler {
-	return &ExportByConsumerHandler{service: service}
+func NewExportByConsumerHandler(service ServiceFunc, options ...Option) *ExportByConsumerHandler {
+	return &ExportByConsumerHandler{exporter: newExporter(service, options...)}
 }
 
 func (h *ExportByConsumerHandler) HandleExportByConsumer(ctx context.Context) error {
@@ -25,11 +26,44 @@ func (h *ExportByConsumerHandler) HandleExportByConsumer(ctx context.Context) er
 		return ErrConsumerParameterNotFound
 	}
 
-	consumer := os.Args[1]
+	var options apigateway.ExportOptions
+
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	period := addTimeRangeFlags(flags)
+	output := addOutputFlags(flags)
+	ephemeral := addEphemeralFlag(flags)
+	flags.BoolVar(&options.Flatten, "flatten", false, "write the nested fields as dotted columns instead of JSON")
+	addColumnsFlag(flags, &options.Columns)
+
+	err := flags.Parse(os.Args[1:])
+
+	if err != nil {
+		return err
+	}
+
+	consumer := flags.Arg(0)
 
 	if consumer == "" {
 		return ErrConsumerParameterCouldNotBeEmpty
 	}
 
-	return h.service.ExportByConsumer(consumer)
+	options.Range, err = period.timeRange()
+
+	if err != nil {
+		return err
+	}
+
+	options.Output, err = output.outputOptions()
+
+	if err != nil {
+		return err
+	}
+
+	s, err := h.exportService(*ephemeral)
+
+	if err != nil {
+		return err
+	}
+
+	return printOutput(s.ExportByConsumer(consumer, options))
 }
@@ -4,15 +4,16 @@ import (
 	"api-gateway-log-parser/pkg/apigateway"
 	"context"
 	"errors"
+	"flag"
 	"os"
 )
 
 type ExportByServiceHandler struct {
-	service apigateway.LogService
+	exporter
 }
 
-func NewExportByServiceHandler(service apigateway.LogService) *ExportByServiceHandler {
-	return &ExportByServiceHandler{service: service}
+func NewExportByServiceHandler(service ServiceFunc, options ...Option) *ExportByServiceHandler {
+	return &ExportByServiceHandler{exporter: newExporter(service, options...)}
 }
 
 var (
@@ -25,11 +26,44 @@ func (h *ExportByServiceHandler) HandleExportByService(ctx context.Context) erro
 		return ErrServiceParameterNotFound
 	}
 
-	service := os.Args[1]
+	var options apigateway.ExportOptions
+
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	period := addTimeRangeFlags(flags)
+	output := addOutputFlags(flags)
+	ephemeral := addEphemeralFlag(flags)
+	flags.BoolVar(&options.Flatten, "flatten", false, "write the nested fields as dotted columns instead of JSON")
+	addColumnsFlag(flags, &options.Columns)
+
+	err := flags.Parse(os.Args[1:])
+
+	if err != nil {
+		return err
+	}
+
+	service := flags.Arg(0)
 
 	if service == "" {
 		return ErrServiceParameterCouldNotBeEmpty
 	}
 
-	return h.service.ExportByService(service)
+	options.Range, err = period.timeRange()
+
+	if err != nil {
+		return err
+	}
+
+	options.Output, err = output.outputOptions()
+
+	if err != nil {
+		return err
+	}
+
+	s, err := h.exportService(*ephemeral)
+
+	if err != nil {
+		return err
+	}
+
+	return printOutput(s.ExportByService(service, options))
 }
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"context"
+	"flag"
+	"os"
+)
+
+type ExportMetricsAllServicesHandler struct {
+	exporter
+}
+
+func NewExportMetricsAllServicesHandler(service ServiceFunc, options ...Option) *ExportMetricsAllServicesHandler {
+	return &ExportMetricsAllServicesHandler{exporter: newExporter(service, options...)}
+}
+
+func (h *ExportMetricsAllServicesHandler) HandleExportMetricsAllServices(ctx context.Context) error {
+	var options apigateway.MetricsOptions
+
+	flags := flag.NewFlagSet("export_metrics_all_services", flag.ContinueOnError)
+	period := addTimeRangeFlags(flags)
+	output := addOutputFlags(flags)
+	ephemeral := addEphemeralFlag(flags)
+	flags.StringVar(&options.SortBy, "sort", "service", "column to sort the services by")
+	flags.BoolVar(&options.Descending, "desc", false, "sort in descending order")
+
+	var args []string
+
+	if len(os.Args) > 1 {
+		args = os.Args[1:]
+	}
+
+	err := flags.Parse(args)
+
+	if err != nil {
+		return err
+	}
+
+	options.Range, err = period.timeRange()
+
+	if err != nil {
+		return err
+	}
+
+	options.Output, err = output.outputOptions()
+
+	if err != nil {
+		return err
+	}
+
+	s, err := h.exportService(*ephemeral)
+
+	if err != nil {
+		return err
+	}
+
+	return printOutput(s.ExportMetricsAllServices(options))
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"context"
+	"flag"
+	"os"
+)
+
+type ExportMetricsByConsumerHandler struct {
+	exporter
+}
+
+func NewExportMetricsByConsumerHandler(service ServiceFunc, options ...Option) *ExportMetricsByConsumerHandler {
+	return &ExportMetricsByConsumerHandler{exporter: newExporter(service, options...)}
+}
+
+func (h *ExportMetricsByConsumerHandler) HandleExportMetricsByConsumer(ctx context.Context) error {
+	if len(os.Args) < 2 {
+		return ErrConsumerParameterNotFound
+	}
+
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	period := addTimeRangeFlags(flags)
+	output := addOutputFlags(flags)
+	ephemeral := addEphemeralFlag(flags)
+
+	err := flags.Parse(os.Args[1:])
+
+	if err != nil {
+		return err
+	}
+
+	consumer := flags.Arg(0)
+
+	if consumer == "" {
+		return ErrConsumerParameterCouldNotBeEmpty
+	}
+
+	var options apigateway.ExportOptions
+
+	options.Range, err = period.timeRange()
+
+	if err != nil {
+		return err
+	}
+
+	options.Output, err = output.outputOptions()
+
+	if err != nil {
+		return err
+	}
+
+	s, err := h.exportService(*ephemeral)
+
+	if err != nil {
+		return err
+	}
+
+	return printOutput(s.ExportMetricsByConsumer(consumer, options))
+}
@@ -3,15 +3,16 @@ package handler
 import (
 	"api-gateway-log-parser/pkg/apigateway"
 	"context"
+	"flag"
 	"os"
 )
 
 type ExportMetricsByServiceHandler struct {
-	service apigateway.LogService
+	exporter
 }
 
-func NewExportMetricsByServiceHandler(service apigateway.LogService) *ExportMetricsByServiceHandler {
-	return &ExportMetricsByServiceHandler{service: service}
+func NewExportMetricsByServiceHandler(service ServiceFunc, options ...Option) *ExportMetricsByServiceHandler {
+	return &ExportMetricsByServiceHandler{exporter: newExporter(service, options...)}
 }
 
 func (h *ExportMetricsByServiceHandler) HandleExportMetricsByService(ctx context.Context) error {
@@ -19,11 +20,42 @@ func (h *ExportMetricsByServiceHandler) HandleExportMetricsByService(ctx context
 		return ErrServiceParameterNotFound
 	}
 
-	service := os.Args[1]
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	period := addTimeRangeFlags(flags)
+	output := addOutputFlags(flags)
+	ephemeral := addEphemeralFlag(flags)
+
+	err := flags.Parse(os.Args[1:])
+
+	if err != nil {
+		return err
+	}
+
+	service := flags.Arg(0)
 
 	if service == "" {
 		return ErrServiceParameterCouldNotBeEmpty
 	}
 
-	return h.service.ExportMetricsByService(service)
+	var options apigateway.ExportOptions
+
+	options.Range, err = period.timeRange()
+
+	if err != nil {
+		return err
+	}
+
+	options.Output, err = output.outputOptions()
+
+	if err != nil {
+		return err
+	}
+
+	s, err := h.exportService(*ephemeral)
+
+	if err != nil {
+		return err
+	}
+
+	return printOutput(s.ExportMetricsByService(service, options))
 }
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"context"
+	"flag"
+	"os"
+	"time"
+)
+
+type ExportMetricsSeriesHandler struct {
+	exporter
+}
+
+func NewExportMetricsSeriesHandler(service ServiceFunc, options ...Option) *ExportMetricsSeriesHandler {
+	return &ExportMetricsSeriesHandler{exporter: newExporter(service, options...)}
+}
+
+func (h *ExportMetricsSeriesHandler) HandleExportMetricsSeries(ctx context.Context) error {
+	if len(os.Args) < 2 {
+		return ErrServiceParameterNotFound
+	}
+
+	var options apigateway.SeriesOptions
+
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	period := addTimeRangeFlags(flags)
+	output := addOutputFlags(flags)
+	ephemeral := addEphemeralFlag(flags)
+	flags.DurationVar(&options.Bucket, "bucket", time.Minute, "size of each time bucket, e.g. 1m or 1h")
+
+	err := flags.Parse(os.Args[1:])
+
+	if err != nil {
+		return err
+	}
+
+	service := flags.Arg(0)
+
+	if service == "" {
+		return ErrServiceParameterCouldNotBeEmpty
+	}
+
+	options.Range, err = period.timeRange()
+
+	if err != nil {
+		return err
+	}
+
+	options.Output, err = output.outputOptions()
+
+	if err != nil {
+		return err
+	}
+
+	s, err := h.exportService(*ephemeral)
+
+	if err != nil {
+		return err
+	}
+
+	return printOutput(s.ExportMetricsSeries(service, options))
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"context"
+	"errors"
+	"flag"
+	"os"
+)
+
+type ExportStatusMetricsHandler struct {
+	exporter
+}
+
+func NewExportStatusMetricsHandler(service ServiceFunc, options ...Option) *ExportStatusMetricsHandler {
+	return &ExportStatusMetricsHandler{exporter: newExporter(service, options...)}
+}
+
+var (
+	ErrGroupParameterNotFound     = errors.New("group parameter not provided")
+	ErrIDParameterCouldNotBeEmpty = errors.New("id parameter could not be empty")
+)
+
+func (h *ExportStatusMetricsHandler) HandleExportStatusMetrics(ctx context.Context) error {
+	if len(os.Args) < 2 {
+		return ErrGroupParameterNotFound
+	}
+
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	period := addTimeRangeFlags(flags)
+	output := addOutputFlags(flags)
+	ephemeral := addEphemeralFlag(flags)
+
+	err := flags.Parse(os.Args[1:])
+
+	if err != nil {
+		return err
+	}
+
+	group := flags.Arg(0)
+	id := flags.Arg(1)
+
+	if id == "" {
+		return ErrIDParameterCouldNotBeEmpty
+	}
+
+	var options apigateway.ExportOptions
+
+	options.Range, err = period.timeRange()
+
+	if err != nil {
+		return err
+	}
+
+	options.Output, err = output.outputOptions()
+
+	if err != nil {
+		return err
+	}
+
+	s, err := h.exportService(*ephemeral)
+
+	if err != nil {
+		return err
+	}
+
+	return printOutput(s.ExportStatusMetrics(group, id, options))
+}
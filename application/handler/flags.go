@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidTime      = errors.New("time must be in RFC3339 or epoch milliseconds")
+	ErrInvalidTimeRange = errors.New("from must not be after to")
+	ErrInvalidDelimiter = errors.New("delimiter must be a single character")
+
+	ErrEphemeralNotSupported = errors.New("ephemeral runs are not supported by this handler")
+)
+
+type timeRangeFlags struct {
+	from string
+	to   string
+}
+
+func addTimeRangeFlags(flags *flag.FlagSet) *timeRangeFlags {
+	t := &timeRangeFlags{}
+
+	flags.StringVar(&t.from, "from", "", "export logs started at or after this time, RFC3339 or epoch milliseconds")
+	flags.StringVar(&t.to, "to", "", "export logs started at or before this time, RFC3339 or epoch milliseconds")
+
+	return t
+}
+
+func (t *timeRangeFlags) timeRange() (apigateway.TimeRange, error) {
+	var period apigateway.TimeRange
+	var err error
+
+	if t.from != "" {
+		period.From, err = parseTime(t.from)
+		if err != nil {
+			return period, err
+		}
+	}
+
+	if t.to != "" {
+		period.To, err = parseTime(t.to)
+		if err != nil {
+			return period, err
+		}
+	}
+
+	if period.To != 0 && period.From > period.To {
+		return period, ErrInvalidTimeRange
+	}
+
+	return period, nil
+}
+
+func parseTime(value string) (int64, error) {
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err == nil {
+		return millis, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, ErrInvalidTime
+	}
+
+	return t.UnixNano() / int64(time.Millisecond), nil
+}
+
+type outputFlags struct {
+	format    string
+	delimiter string
+	quoteAll  bool
+	noHeader  bool
+	path      string
+	fileName  string
+}
+
+func addOutputFlags(flags *flag.FlagSet) *outputFlags {
+	f := &outputFlags{}
+
+	flags.StringVar(&f.format, "format", apigateway.FormatCSV, "format of the export: csv, json, jsonl or parquet")
+	flags.StringVar(&f.delimiter, "delimiter", ";", `delimiter of the csv columns, \t for tabs`)
+	flags.BoolVar(&f.quoteAll, "quote-all", false, "quote every csv field, not only the ones that need it")
+	flags.BoolVar(&f.noHeader, "no-header", false, "write the csv without the header")
+	flags.StringVar(&f.path, "output", "", "file or directory to write the export to, - for stdout")
+	flags.StringVar(&f.fileName, "filename", "", "name of the file written to a directory, with {prefix}, {id}, {date} and {ext}")
+
+	return f
+}
+
+func (f *outputFlags) outputOptions() (apigateway.OutputOptions, error) {
+	delimiter := []rune(strings.Replace(f.delimiter, `\t`, "\t", 1))
+
+	if len(delimiter) != 1 {
+		return apigateway.OutputOptions{}, ErrInvalidDelimiter
+	}
+
+	return apigateway.OutputOptions{
+		Format:    f.format,
+		Delimiter: delimiter[0],
+		QuoteAll:  f.quoteAll,
+		NoHeader:  f.noHeader,
+		Path:      f.path,
+		FileName:  f.fileName,
+	}, nil
+}
+
+// printOutput prints where the export was written, so scripts can pick the
+// file up, unless it was written to stdout.
+func printOutput(path string, err error) error {
+	if err != nil || path == apigateway.Stdout {
+		return err
+	}
+
+	fmt.Println(path)
+
+	return nil
+}
+
+// listFlag is a comma separated list of values, e.g. request.method,started_at.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = nil
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+
+	return nil
+}
+
+func addColumnsFlag(flags *flag.FlagSet, columns *[]string) {
+	flags.Var((*listFlag)(columns), "columns", "comma separated fields to export, in order, nested ones like response.status")
+}
+
+const ephemeralFlag = "ephemeral"
+
+func addEphemeralFlag(flags *flag.FlagSet) *string {
+	return flags.String(ephemeralFlag, "", "parse the logs of this file, directory or glob on memory and export them, without a database")
+}
+
+// ServiceFunc builds the service an export handler runs on once the handler
+// knows which one it needs, so a run with --ephemeral opens no database.
+type ServiceFunc func() (apigateway.LogService, error)
+
+// Option sets up an export handler.
+type Option func(e *exporter)
+
+// WithEphemeralService builds the service that --ephemeral parses the logs
+// into and exports them from, which keeps them on memory.
+func WithEphemeralService(newService ServiceFunc) Option {
+	return func(e *exporter) {
+		e.newEphemeral = newService
+	}
+}
+
+// exporter builds the service an export handler runs on, the stored logs' or
+// the one of a run with --ephemeral.
+type exporter struct {
+	newService   ServiceFunc
+	newEphemeral ServiceFunc
+}
+
+func newExporter(newService ServiceFunc, options ...Option) exporter {
+	e := exporter{newService: newService}
+
+	for _, option := range options {
+		option(&e)
+	}
+
+	return e
+}
+
+// exportService is the service to export from. Given the logs to parse with
+// --ephemeral, it is a new one with them parsed, with no checkpoint, as they
+// are gone once the run ends.
+func (e *exporter) exportService(pattern string) (apigateway.LogService, error) {
+	if pattern == "" {
+		return e.newService()
+	}
+
+	if e.newEphemeral == nil {
+		return nil, ErrEphemeralNotSupported
+	}
+
+	service, err := e.newEphemeral()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = service.Parse(pattern, apigateway.ParseOptions{NoCheckpoint: true}); err != nil {
+		return nil, err
+	}
+
+	return service, nil
+}
@@ -4,6 +4,8 @@ import (
 	"api-gateway-log-parser/pkg/apigateway"
 	"context"
 	"errors"
+	"flag"
+	"fmt"
 	"os"
 )
 
@@ -14,6 +16,8 @@ type LogParserHandler struct {
 var (
 	ErrPathParameterNotFound        = errors.New("path parameter not provided")
 	ErrPathParameterCouldNotBeEmpty = errors.New("path parameter could not be empty")
+	ErrResumeWithoutCheckpoint      = errors.New("resume needs the checkpoint, it cannot be used with no-checkpoint")
+	ErrLenientStream                = errors.New("lenient cannot be used with stream, a stream cannot go on after a malformed value")
 )
 
 func NewLogParserHandler(service apigateway.LogService) *LogParserHandler {
@@ -25,11 +29,48 @@ func (h *LogParserHandler) HandleApiGatewayLogParser(ctx context.Context) error
 		return ErrPathParameterNotFound
 	}
 
-	path := os.Args[1]
+	var options apigateway.ParseOptions
 
-	if path == "" {
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flags.BoolVar(&options.Resume, "resume", false, "continue from the last checkpoint of the file")
+	flags.BoolVar(&options.Lenient, "lenient", false, "skip malformed and empty lines instead of stopping")
+	flags.StringVar(&options.DeadLetterPath, "dead-letter", "", "file where the malformed lines are written (default {path}.rejected.jsonl)")
+	flags.IntVar(&options.MaxLineSize, "max-line-size", 0, "max size of a line in bytes, longer lines are rejected (default 1MB)")
+	flags.BoolVar(&options.Stream, "stream", false, "decode the input as a stream of JSON values instead of one log per line")
+	flags.BoolVar(&options.NoCheckpoint, "no-checkpoint", false, "do not write a checkpoint next to the file, e.g. on read-only locations")
+
+	err := flags.Parse(os.Args[1:])
+
+	if err != nil {
+		return err
+	}
+
+	if options.Resume && options.NoCheckpoint {
+		return ErrResumeWithoutCheckpoint
+	}
+
+	if options.Lenient && options.Stream {
+		return ErrLenientStream
+	}
+
+	pattern := flags.Arg(0)
+
+	if pattern == "" {
 		return ErrPathParameterCouldNotBeEmpty
 	}
 
-	return h.service.Parse(path)
+	report, err := h.service.Parse(pattern, options)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d logs accepted, %d rejected\n", report.Accepted, report.Rejected)
+	fmt.Printf("%d new, %d duplicates\n", report.New, report.Duplicates)
+
+	for _, path := range report.DeadLetterPaths {
+		fmt.Printf("rejected lines written to %s\n", path)
+	}
+
+	return nil
 }
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"context"
+	"flag"
+	"os"
+)
+
+type TopHandler struct {
+	exporter
+}
+
+func NewTopHandler(service ServiceFunc, options ...Option) *TopHandler {
+	return &TopHandler{exporter: newExporter(service, options...)}
+}
+
+func (h *TopHandler) HandleTop(ctx context.Context) error {
+	var options apigateway.TopOptions
+
+	flags := flag.NewFlagSet("top", flag.ContinueOnError)
+	period := addTimeRangeFlags(flags)
+	output := addOutputFlags(flags)
+	ephemeral := addEphemeralFlag(flags)
+	flags.StringVar(&options.By, "by", "route", "entity to rank: route, service, consumer, client_ip or upstream_uri")
+	flags.StringVar(&options.Metric, "metric", "requests", "metric to rank by: requests, errors, response_bytes or request_p95")
+	flags.IntVar(&options.Limit, "limit", 10, "how many entities to report")
+
+	var args []string
+
+	if len(os.Args) > 1 {
+		args = os.Args[1:]
+	}
+
+	err := flags.Parse(args)
+
+	if err != nil {
+		return err
+	}
+
+	options.Range, err = period.timeRange()
+
+	if err != nil {
+		return err
+	}
+
+	options.Output, err = output.outputOptions()
+
+	if err != nil {
+		return err
+	}
+
+	s, err := h.exportService(*ephemeral)
+
+	if err != nil {
+		return err
+	}
+
+	return printOutput(s.Top(options))
+}
@@ -5,14 +5,16 @@ package service
 import (
 	"api-gateway-log-parser/pkg/apigateway"
 	"api-gateway-log-parser/pkg/apigateway/repository"
+	"api-gateway-log-parser/pkg/apigateway/repository/driver"
+	"api-gateway-log-parser/pkg/exporter"
 	mock "api-gateway-log-parser/test/mocks"
 	"bytes"
 	"encoding/csv"
 	"errors"
 	as "github.com/stretchr/testify/assert"
 	m "github.com/stretchr/testify/mock"
+	"io/ioutil"
 	"strings"
-	"sync"
 	"testing"
 )
 
@@ -20,13 +22,10 @@ func TestApiGatewayLogService_ShouldWriteColumns(t *testing.T) {
 	assert := as.New(t)
 
 	filesystem := mock.FileSystemMock{}
+	file := mock.FileMock{}
 
 	service, _ := NewApiGatewayLogParserService(nil, &filesystem)
 
-	var buffer bytes.Buffer
-	w := csv.NewWriter(&buffer)
-	defer w.Flush()
-
 	columns := []string{
 		"request",
 		"upstream_uri",
@@ -39,55 +38,61 @@ func TestApiGatewayLogService_ShouldWriteColumns(t *testing.T) {
 		"started_at",
 		"service_id",
 		"consumer_id",
+		"id",
 	}
 
 	columnsStr := strings.Join(columns, ";") + "\n"
 
-	filesystem.On("Write", m.Anything, columnsStr).Return(nil).Once()
+	filesystem.On("Create", "test.csv").Return(&file, nil).Once()
+	filesystem.On("IsDir", "test.csv").Return(false).Once()
+	file.On("Commit", columnsStr).Return(nil).Once()
+
+	options := apigateway.ExportOptions{Output: apigateway.OutputOptions{Path: "test.csv"}}
+
+	driverMock := mock.DriverMock{}
+	driverMock.On("Query", m.Anything, "").Return(driver.Page{}, nil).Once()
 
-	err := service.writeColumns(w, "test.csv", &buffer)
+	cursor := repository.NewApiGatewayLogRepository(&driverMock).GetByService("id", apigateway.TimeRange{}, itemsPerPage)
+
+	path, err := service.exportLogs("service", "id", options, cursor)
 
 	assert.Nil(err)
+	assert.Equal("test.csv", path)
+	assert.False(file.Aborted)
+	file.AssertExpectations(t)
 }
 
-func TestApiGatewayLogService_ShouldReturnErrorOnWriteColumns(t *testing.T) {
+func TestApiGatewayLogService_ShouldAbortOnCommitError(t *testing.T) {
 	assert := as.New(t)
 
 	filesystem := mock.FileSystemMock{}
+	file := mock.FileMock{}
 
 	service, _ := NewApiGatewayLogParserService(nil, &filesystem)
 
-	var buffer bytes.Buffer
-	w := csv.NewWriter(&buffer)
-	defer w.Flush()
+	filesystemErr := errors.New("error on writing file")
 
-	columns := []string{
-		"request",
-		"upstream_uri",
-		"response",
-		"authenticated_entity",
-		"route",
-		"service",
-		"latencies",
-		"client_ip",
-		"started_at",
-		"service_id",
-		"consumer_id",
-	}
+	filesystem.On("Create", "test.csv").Return(&file, nil).Once()
+	filesystem.On("IsDir", "test.csv").Return(false).Once()
+	file.On("Commit", m.Anything).Return(filesystemErr).Once()
 
-	columnsStr := strings.Join(columns, ";") + "\n"
+	options := apigateway.ExportOptions{Output: apigateway.OutputOptions{Path: "test.csv"}}
 
-	filesystemErr := errors.New("error on writing file")
+	driverMock := mock.DriverMock{}
+	driverMock.On("Query", m.Anything, "").Return(driver.Page{}, nil).Once()
 
-	filesystem.On("Write", m.Anything, columnsStr).Return(filesystemErr).Once()
+	cursor := repository.NewApiGatewayLogRepository(&driverMock).GetByService("id", apigateway.TimeRange{}, itemsPerPage)
 
-	err := service.writeColumns(w, "test.csv", &buffer)
+	path, err := service.exportLogs("service", "id", options, cursor)
 
-	assert.NotNil(err)
-	assert.Same(err, filesystemErr)
+	assert.Same(filesystemErr, err)
+	assert.Empty(path)
+	assert.True(file.Aborted)
 }
 
 func TestApiGatewayLogService_ShouldAddLogs(t *testing.T) {
+	assert := as.New(t)
+
 	var logs []*apigateway.Log
 
 	consumerID := "29a5a16b-e4fa-331f-9f1c-5adea563d7de"
@@ -110,38 +115,62 @@ func TestApiGatewayLogService_ShouldAddLogs(t *testing.T) {
 
 	driverMock := mock.DriverMock{}
 	repo := repository.NewApiGatewayLogRepository(&driverMock)
-	driverMock.On("AddBatch", logs).Return(nil).Once()
+	driverMock.On("AddBatch", logs).Return(1, nil).Once()
 
 	service, _ := NewApiGatewayLogParserService(repo, nil)
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-
-	service.addLogs(logs, &wg)
+	added, err := service.addLogs(logs)
 
-	wg.Wait()
+	assert.Nil(err)
+	assert.Equal(1, added)
 }
 
 func TestApiGatewayLogService_ShouldReturnErrorOnAddLogs(t *testing.T) {
+	assert := as.New(t)
+
 	var logs []*apigateway.Log
 
 	driverErr := errors.New("error on writing file")
 
 	driverMock := mock.DriverMock{}
 	repo := repository.NewApiGatewayLogRepository(&driverMock)
-	driverMock.On("AddBatch", logs).Return(driverErr).Once()
+	driverMock.On("AddBatch", logs).Return(0, driverErr).Once()
 
 	service, _ := NewApiGatewayLogParserService(repo, nil)
 
-	var wg sync.WaitGroup
-	wg.Add(1)
+	_, err := service.addLogs(logs)
 
-	service.addLogs(logs, &wg)
+	assert.NotNil(err)
+	assert.Same(err, driverErr)
+}
 
-	wg.Wait()
+func TestApiGatewayLogService_ShouldReportNewAndDuplicateLogs(t *testing.T) {
+	assert := as.New(t)
+
+	path := "logs.txt"
+	file := ioutil.NopCloser(strings.NewReader(`{"started_at":1,"service":{"id":"s"}}` + "\n" + `{"started_at":2,"service":{"id":"s"}}`))
+
+	filesystem := mock.FileSystemMock{}
+	filesystem.On("Resolve", path).Return([]string{path}, nil).Once()
+	filesystem.On("Fingerprint", path).Return("fingerprint", nil).Once()
+	filesystem.On("Open", path).Return(file).Once()
+	filesystem.On("Replace", path+".checkpoint", m.Anything).Return(nil).Twice()
+
+	// The first log was stored by an earlier parse.
+	driverMock := mock.DriverMock{}
+	driverMock.On("AddBatch", m.Anything).Return(1, nil).Once()
+
+	service, _ := NewApiGatewayLogParserService(repository.NewApiGatewayLogRepository(&driverMock), &filesystem)
+
+	report, err := service.Parse(path, apigateway.ParseOptions{})
+
+	assert.Nil(err)
+	assert.Equal(2, report.Accepted)
+	assert.Equal(1, report.New)
+	assert.Equal(1, report.Duplicates)
 }
 
-func TestApiGatewayLogService_ShouldWriteLogsToFile(t *testing.T) {
+func TestApiGatewayLogService_ShouldWriteLogs(t *testing.T) {
 	assert := as.New(t)
 
 	var logs []*apigateway.Log
@@ -164,56 +193,63 @@ func TestApiGatewayLogService_ShouldWriteLogsToFile(t *testing.T) {
 		ConsumerID:          consumerID,
 	})
 
-	fileName := "teste.csv"
-
-	filesystem := mock.FileSystemMock{}
-
 	var bufferTest bytes.Buffer
 	wTest := csv.NewWriter(&bufferTest)
-	defer wTest.Flush()
+	wTest.Comma = ';'
 
-	values := getValuesFromLogs(logs)
+	values := getValuesFromLogs(logs, (*apigateway.Log).ToSlice)
 	wTest.WriteAll(values)
 
 	var buffer bytes.Buffer
-	w := csv.NewWriter(&buffer)
-	defer w.Flush()
-
-	filesystem.On("Write", fileName, bufferTest.String()).Return(nil).Once()
 
-	service, _ := NewApiGatewayLogParserService(nil, &filesystem)
+	exp, _ := exporter.New(&buffer, apigateway.GetJsonFieldsFromLogStruct(), apigateway.GetJsonTypesFromLogStruct(), apigateway.OutputOptions{NoHeader: true})
 
-	err := service.writeLogsToFile(logs, w, fileName, &buffer)
+	err := writeLogs(logs, (*apigateway.Log).ToSlice, exp)
 
 	assert.Nil(err)
+	assert.Nil(exp.Close())
+	assert.Equal(bufferTest.String(), buffer.String())
 }
 
-func TestApiGatewayLogService_ShouldReturnErrorOnWriteLogsToFile(t *testing.T) {
+func TestApiGatewayLogService_ShouldAbortOnGettingLogsError(t *testing.T) {
 	assert := as.New(t)
 
-	var logs []*apigateway.Log
-	fileName := "teste.csv"
-
 	filesystem := mock.FileSystemMock{}
+	file := mock.FileMock{}
 
-	var bufferTest bytes.Buffer
-	wTest := csv.NewWriter(&bufferTest)
-	defer wTest.Flush()
+	service, _ := NewApiGatewayLogParserService(nil, &filesystem, WithOutputDir("exports"))
 
-	values := getValuesFromLogs(logs)
-	wTest.WriteAll(values)
+	driverErr := errors.New("error on getting logs")
 
-	var buffer bytes.Buffer
-	w := csv.NewWriter(&buffer)
-	defer w.Flush()
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
 
-	filesystemErr := errors.New("error on writing file")
-	filesystem.On("Write", fileName, bufferTest.String()).Return(filesystemErr).Once()
+	driverMock := mock.DriverMock{}
+	driverMock.On("Query", m.Anything, "").Return(driver.Page{}, driverErr).Once()
 
-	service, _ := NewApiGatewayLogParserService(nil, &filesystem)
+	cursor := repository.NewApiGatewayLogRepository(&driverMock).GetByService("id", apigateway.TimeRange{}, itemsPerPage)
 
-	err := service.writeLogsToFile(logs, w, fileName, &buffer)
+	path, err := service.exportLogs("service", "id", apigateway.ExportOptions{}, cursor)
 
-	assert.NotNil(err)
-	assert.Same(err, filesystemErr)
+	assert.Same(driverErr, err)
+	assert.Empty(path)
+	assert.True(file.Aborted)
+	file.AssertNotCalled(t, "Commit", m.Anything)
+}
+
+func TestApiGatewayLogService_ShouldCommitCheckpointInOrder(t *testing.T) {
+	assert := as.New(t)
+
+	filesystem := mock.FileSystemMock{}
+
+	tracker := newCheckpointTracker(&filesystem, checkpoint{Path: "logs.txt", Fingerprint: "fingerprint"})
+
+	filesystem.On("Replace", "logs.txt.checkpoint", `{"path":"logs.txt","fingerprint":"fingerprint","offset":300,"line":3}`).
+		Return(nil).
+		Once()
+
+	assert.Nil(tracker.ack(2, 300, 3))
+	assert.Nil(tracker.ack(1, 200, 2))
+	assert.Nil(tracker.ack(0, 100, 1))
+
+	filesystem.AssertExpectations(t)
 }
@@ -3,178 +3,584 @@ package service
 import (
 	"api-gateway-log-parser/pkg/apigateway"
 	"api-gateway-log-parser/pkg/apigateway/repository"
+	"api-gateway-log-parser/pkg/exporter"
 	"api-gateway-log-parser/pkg/filesystem"
-	"bytes"
-	"encoding/csv"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"math/rand"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
-const itemsPerPage = 1000
+const (
+	itemsPerPage    = 1000
+	logsBatchMaxLen = 200
+	defaultWorkers  = 4
+	defaultFileName = "{prefix}-{id}-{date}.{ext}"
+)
 
 type ApiGatewayLogService struct {
 	repo       *repository.ApiGatewayLogRepository
 	filesystem filesystem.API
+	workers    int
+	outputDir  string
+}
+
+type Option func(*ApiGatewayLogService)
+
+func WithWorkers(workers int) Option {
+	return func(a *ApiGatewayLogService) {
+		if workers > 0 {
+			a.workers = workers
+		}
+	}
 }
 
-func NewApiGatewayLogParserService(repo *repository.ApiGatewayLogRepository, filesystem filesystem.API) (*ApiGatewayLogService, error) {
-	return &ApiGatewayLogService{
+// WithOutputDir is where the exports are written when no output is given.
+func WithOutputDir(dir string) Option {
+	return func(a *ApiGatewayLogService) {
+		if dir != "" {
+			a.outputDir = dir
+		}
+	}
+}
+
+func NewApiGatewayLogParserService(repo *repository.ApiGatewayLogRepository, filesystem filesystem.API, options ...Option) (*ApiGatewayLogService, error) {
+	s := &ApiGatewayLogService{
 		repo:       repo,
 		filesystem: filesystem,
-	}, nil
+		workers:    defaultWorkers,
+		outputDir:  ".",
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	return s, nil
+}
+
+// writeCounts adds up, across the writers, the logs written and how many of
+// them were not stored yet.
+type writeCounts struct {
+	sync.Mutex
+	written int
+	added   int
 }
 
-func (a *ApiGatewayLogService) Parse(path string) error {
+func (c *writeCounts) add(written int, added int) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.written += written
+	c.added += added
+}
+
+type batch struct {
+	seq    int
+	logs   []*apigateway.Log
+	offset int64
+	line   int
+}
+
+func (a *ApiGatewayLogService) Parse(pattern string, options apigateway.ParseOptions) (apigateway.ParseReport, error) {
+	var report apigateway.ParseReport
+
+	paths, err := a.filesystem.Resolve(pattern)
+
+	if err != nil {
+		return report, err
+	}
+
+	rejects := newDeadLetters(a.filesystem, options.Resume)
+
+	for _, path := range paths {
+		if isParseArtifact(path) {
+			continue
+		}
+
+		err = a.parseFile(path, options, rejects, &report)
+
+		if err != nil {
+			break
+		}
+	}
+
+	closeErr := rejects.close()
+
+	if err == nil {
+		err = closeErr
+	}
+
+	return report, err
+}
+
+func (a *ApiGatewayLogService) parseFile(path string, options apigateway.ParseOptions, rejects *deadLetters, report *apigateway.ParseReport) error {
+	deadLetter := options.DeadLetterPath
+
+	if deadLetter == "" {
+		deadLetter = deadLetterPath(path)
+	}
+
+	var tracker *checkpointTracker
+
+	start := checkpoint{Path: path}
+
+	// Stdin cannot be read again, so there is nothing to resume from.
+	if path != filesystem.Stdin && !options.NoCheckpoint {
+		fingerprint, err := a.filesystem.Fingerprint(path)
+
+		if err != nil {
+			return err
+		}
+
+		start.Fingerprint = fingerprint
+
+		if options.Resume {
+			start, err = readCheckpoint(a.filesystem, path, fingerprint)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if start.Completed {
+			return nil
+		}
+
+		tracker = newCheckpointTracker(a.filesystem, start)
+	}
+
+	var deadLetterWriter io.Writer
+
+	if options.Lenient {
+		w, err := rejects.open(deadLetter)
+
+		if err != nil {
+			return err
+		}
+
+		deadLetterWriter = w
+	}
+
 	file, err := a.filesystem.Open(path)
 
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	defer file.Close()
 
-	scanner := a.filesystem.GetScanner(file)
+	if start.Offset > 0 {
+		err = skip(file, start.Offset)
 
-	var logs []*apigateway.Log
+		if err != nil {
+			return err
+		}
+	}
+
+	var records recordReader = newLineReader(file, start.Offset, options.MaxLineSize)
+
+	// A stream counts its JSON values, which may span many lines or share one.
+	unit := "line"
+
+	if options.Stream {
+		records = newJsonStreamReader(file, start.Offset)
+		unit = "record"
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var writeErr error
+	var once sync.Once
+
+	fail := func(err error) {
+		once.Do(func() {
+			writeErr = err
+			cancel()
+		})
+	}
+
+	// The channel is bounded by the number of writers, so the scanner blocks
+	// instead of buffering the whole file when DynamoDB falls behind.
+	batches := make(chan batch, a.workers)
 
 	var wg sync.WaitGroup
+	var counts writeCounts
 
-	logsBatchMaxLen := 200
+	for i := 0; i < a.workers; i++ {
+		wg.Add(1)
+		go a.writeBatches(ctx, batches, tracker, &counts, fail, &wg)
+	}
 
-	for scanner.Scan() {
+	seq := 0
+	line := start.Line
+	rejected := 0
+
+	send := func(logs []*apigateway.Log) bool {
+		select {
+		case batches <- batch{seq: seq, logs: logs, offset: records.Offset(), line: line}:
+			seq++
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	var logs []*apigateway.Log
+
+	eof := false
+
+	for {
 		var apiGatewayLog apigateway.Log
+		var data []byte
 
-		line := []byte(a.filesystem.GetLine(scanner))
+		data, err = records.Next()
 
-		if len(line) == 0 {
+		if err == io.EOF {
+			err = nil
+			eof = true
 			break
 		}
 
-		err = json.Unmarshal(line, &apiGatewayLog)
+		line++
+
+		// Only an oversized line leaves the reader in a state to go on.
+		if err != nil && !errors.Is(err, ErrLineTooLong) {
+			err = fmt.Errorf("%s %d: %w", unit, line, err)
+			break
+		}
+
+		if err == nil && len(data) == 0 && !options.Lenient {
+			err = fmt.Errorf("%s %d: %w", unit, line, ErrEmptyLine)
+			break
+		}
+
+		if err == nil && len(data) == 0 {
+			continue
+		}
+
+		if err == nil {
+			err = json.Unmarshal(data, &apiGatewayLog)
+		}
+
+		if err != nil && options.Lenient {
+			rejected++
+
+			err = rejects.reject(deadLetterWriter, path, line, data, err)
+			if err != nil {
+				break
+			}
+
+			continue
+		}
 
 		if err != nil {
-			return err
+			err = fmt.Errorf("%s %d: %w", unit, line, err)
+			break
 		}
 
+		report.Accepted++
+
 		apiGatewayLog.ServiceID = apiGatewayLog.Service.ID
 		apiGatewayLog.ConsumerID = apiGatewayLog.AuthenticatedEntity.ConsumerID.UUID
+		apiGatewayLog.ID = apigateway.NewLogID(&apiGatewayLog)
 
 		logs = append(logs, &apiGatewayLog)
 
 		if len(logs) > logsBatchMaxLen {
-			wg.Add(1)
-
-			a.addLogs(logs, &wg)
+			if !send(logs) {
+				break
+			}
 
 			logs = nil
 		}
 	}
 
+	if err == nil && len(logs) > 0 {
+		send(logs)
+	}
+
+	close(batches)
 	wg.Wait()
 
-	if err = scanner.Err(); err != nil {
-		log.Fatal(err)
+	report.New += counts.added
+	report.Duplicates += counts.written - counts.added
+
+	if rejected > 0 {
+		report.Rejected += rejected
+		report.DeadLetterPaths = appendPath(report.DeadLetterPaths, deadLetter)
 	}
 
-	return nil
+	if writeErr != nil {
+		return writeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Only a file read to its end is complete, otherwise the checkpoint keeps
+	// the offset of the last batch written, to resume from there.
+	if !eof {
+		return nil
+	}
+
+	return tracker.complete()
 }
 
-func (a *ApiGatewayLogService) ExportByService(service string) error {
-	fileName := generateFileName("service", service)
+func (a *ApiGatewayLogService) ExportByService(service string, options apigateway.ExportOptions) (string, error) {
+	return a.exportLogs("service", service, options, a.repo.GetByService(service, options.Range, itemsPerPage))
+}
 
-	var buffer bytes.Buffer
-	w := csv.NewWriter(&buffer)
-	defer w.Flush()
+func (a *ApiGatewayLogService) ExportByConsumer(consumer string, options apigateway.ExportOptions) (string, error) {
+	return a.exportLogs("consumer", consumer, options, a.repo.GetByConsumer(consumer, options.Range, itemsPerPage))
+}
 
-	err := a.writeColumns(w, fileName, &buffer)
+// exportLogs writes each page of logs to the file as soon as it is exported,
+// so the logs are not all kept in memory. The file only shows up on its path
+// once the export is complete.
+func (a *ApiGatewayLogService) exportLogs(prefix string, id string, options apigateway.ExportOptions, cursor *repository.Cursor) (string, error) {
+	fileName, err := a.outputPath(prefix, id, options.Output)
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	columns, types, toSlice, err := logColumns(options)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := a.filesystem.Create(fileName)
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Abort()
+
+	exp, err := exporter.New(file, columns, types, options.Output)
+	if err != nil {
+		return "", err
 	}
 
 	for {
-		logs, err := a.repo.GetByService(service, itemsPerPage)
+		logs, err := cursor.Next()
 
 		if err != nil {
-			return err
+			return "", err
 		}
 
 		if logs == nil {
 			break
 		}
 
-		err = a.writeLogsToFile(logs, w, fileName, &buffer)
+		err = writeLogs(logs, toSlice, exp)
 		if err != nil {
-			return err
+			return "", err
 		}
 	}
 
-	return nil
+	return commit(fileName, file, exp)
 }
 
-func (a *ApiGatewayLogService) ExportByConsumer(consumer string) error {
-	fileName := generateFileName("consumer", consumer)
+// exportRows writes the rows of the metrics exports, which are small enough
+// to be written at once. Their first labels columns say what each row is
+// about, e.g. a service ID, and the others are numbers.
+func (a *ApiGatewayLogService) exportRows(fileName string, columns []string, labels int, rows [][]string, options apigateway.OutputOptions) (string, error) {
+	file, err := a.filesystem.Create(fileName)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Abort()
 
-	var buffer bytes.Buffer
+	types := make([]apigateway.ColumnType, len(columns))
 
-	w := csv.NewWriter(&buffer)
-	defer w.Flush()
+	for i := range types {
+		types[i] = apigateway.ColumnNumber
+
+		if i < labels {
+			types[i] = apigateway.ColumnString
+		}
+	}
+
+	exp, err := exporter.New(file, columns, types, options)
 
-	err := a.writeColumns(w, fileName, &buffer)
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	for _, row := range rows {
+		err = exp.Write(row)
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return commit(fileName, file, exp)
+}
+
+// commit closes the exporter, writing what it still buffers, before the file
+// replaces its path.
+func commit(fileName string, file filesystem.File, exp exporter.Exporter) (string, error) {
+	err := exp.Close()
+
+	if err == nil {
+		err = file.Commit()
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return fileName, nil
+}
+
+func (a *ApiGatewayLogService) ExportMetricsByService(service string, options apigateway.ExportOptions) (string, error) {
+	path, err := a.outputPath("metrics", service, options.Output)
+
+	if err != nil {
+		return "", err
+	}
+
+	summary, aggregated, err := a.repo.SummarizeServiceLatencies(service, options.Range, quantiles())
+
+	if err != nil {
+		return "", err
 	}
 
+	var values []string
+
+	// Drivers that cannot aggregate have their logs read instead.
+	if aggregated {
+		values = summaryValues(summary)
+	} else {
+		values, err = a.serviceLatencies(service, options.Range)
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	rows := [][]string{append([]string{service}, values...)}
+
+	return a.exportRows(path, append([]string{"service"}, latencyColumns()...), 1, rows, options.Output)
+}
+
+func (a *ApiGatewayLogService) serviceLatencies(service string, period apigateway.TimeRange) ([]string, error) {
+	latencies := newLatencyMetrics()
+
+	cursor := a.repo.GetByService(service, period, itemsPerPage)
+
 	for {
-		logs, err := a.repo.GetByConsumer(consumer, itemsPerPage)
+		logs, err := cursor.Next()
 
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		if logs == nil {
 			break
 		}
 
-		err = a.writeLogsToFile(logs, w, fileName, &buffer)
+		for _, l := range logs {
+			latencies.add(l)
+		}
+	}
+
+	return latencies.values(), nil
+}
+
+// ExportMetricsByConsumer has a row for each service the consumer called and
+// a total row at the end.
+func (a *ApiGatewayLogService) ExportMetricsByConsumer(consumer string, options apigateway.ExportOptions) (string, error) {
+	path, err := a.outputPath("metrics-consumer", consumer, options.Output)
+
+	if err != nil {
+		return "", err
+	}
+
+	total := newUsageMetrics()
+	services := map[string]*usageMetrics{}
+
+	cursor := a.repo.GetByConsumer(consumer, options.Range, itemsPerPage)
+
+	for {
+		logs, err := cursor.Next()
+
 		if err != nil {
-			return err
+			return "", err
+		}
+
+		if logs == nil {
+			break
+		}
+
+		for _, l := range logs {
+			u, ok := services[l.ServiceID]
+
+			if !ok {
+				u = newUsageMetrics()
+				services[l.ServiceID] = u
+			}
+
+			u.add(l)
+			total.add(l)
 		}
 	}
 
-	return nil
+	var rows [][]string
+
+	for service, u := range services {
+		rows = append(rows, append([]string{consumer, service}, u.values()...))
+	}
+
+	sortRows(rows, 1, false)
+
+	rows = append(rows, append([]string{consumer, "total"}, total.values()...))
+
+	return a.exportRows(path, usageColumns(), 2, rows, options.Output)
 }
 
-func (a *ApiGatewayLogService) ExportMetricsByService(service string) error {
-	fileName := generateFileName("metrics", service)
+func (a *ApiGatewayLogService) ExportMetricsAllServices(options apigateway.MetricsOptions) (string, error) {
+	path, err := a.outputPath("metrics", "all-services", options.Output)
+
+	if err != nil {
+		return "", err
+	}
+
+	columns := append([]string{"service", "service_name", "requests"}, latencyColumns()...)
 
-	var buffer bytes.Buffer
-	w := csv.NewWriter(&buffer)
-	defer w.Flush()
+	sortBy := options.SortBy
 
-	columns := []string{"service", "request_avg", "proxy_avg", "gateway_avg"}
+	if sortBy == "" {
+		sortBy = "service"
+	}
 
-	separator := ';'
-	w.Comma = separator
-	err := w.WriteAll([][]string{columns})
+	sortIndex, err := columnIndex(columns, sortBy)
 
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	var requestAvg, proxyAvg, gatewayAvg float64
-	var requestSum, proxySum, gatewaySum int
+	services := map[string]*serviceMetrics{}
 
-	numberOfLogs := 0
+	cursor := a.repo.GetAll(options.Range, itemsPerPage)
 
 	for {
-		logs, err := a.repo.GetByService(service, itemsPerPage)
+		logs, err := cursor.Next()
 
 		if err != nil {
-			return err
+			return "", err
 		}
 
 		if logs == nil {
@@ -182,99 +588,362 @@ func (a *ApiGatewayLogService) ExportMetricsByService(service string) error {
 		}
 
 		for _, l := range logs {
-			requestSum += l.Latencies.Request
-			proxySum += l.Latencies.Proxy
-			gatewaySum += l.Latencies.Gateway
+			s, ok := services[l.ServiceID]
 
-			numberOfLogs += 1
+			if !ok {
+				s = &serviceMetrics{latencies: newLatencyMetrics()}
+				services[l.ServiceID] = s
+			}
+
+			if l.Service.Name != "" {
+				s.name = l.Service.Name
+			}
+
+			s.latencies.add(l)
 		}
 	}
 
-	requestAvg = float64(requestSum) / float64(numberOfLogs)
-	proxyAvg = float64(proxySum) / float64(numberOfLogs)
-	gatewayAvg = float64(gatewaySum) / float64(numberOfLogs)
+	var rows [][]string
+
+	for id, s := range services {
+		row := []string{id, s.name, strconv.FormatUint(s.latencies.count(), 10)}
+
+		rows = append(rows, append(row, s.latencies.values()...))
+	}
+
+	sortRows(rows, sortIndex, options.Descending)
+
+	return a.exportRows(path, columns, 2, rows, options.Output)
+}
+
+func (a *ApiGatewayLogService) ExportMetricsSeries(service string, options apigateway.SeriesOptions) (string, error) {
+	size := int64(options.Bucket / time.Millisecond)
+
+	if size <= 0 {
+		return "", ErrInvalidBucket
+	}
 
-	metrics := []string{
-		service,
-		fmt.Sprintf("%.2f", requestAvg),
-		fmt.Sprintf("%.2f", proxyAvg),
-		fmt.Sprintf("%.2f", gatewayAvg),
+	// A time range given up front is checked before reading any log.
+	if options.Range.From != 0 && options.Range.To != 0 && bucketCount(options.Range.From, options.Range.To, size) > maxSeriesBuckets {
+		return "", ErrTooManyBuckets
 	}
 
-	err = w.WriteAll([][]string{metrics})
+	path, err := a.outputPath("series", service, options.Output)
 
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	buckets := map[int64]*bucketMetrics{}
+
+	cursor := a.repo.GetByService(service, options.Range, itemsPerPage)
+
+	for {
+		logs, err := cursor.Next()
+
+		if err != nil {
+			return "", err
+		}
+
+		if logs == nil {
+			break
+		}
+
+		for _, l := range logs {
+			start := l.StartedAt - l.StartedAt%size
+
+			b, ok := buckets[start]
+
+			if !ok {
+				b = newBucketMetrics()
+				buckets[start] = b
+			}
+
+			b.add(l)
+		}
 	}
 
-	err = a.filesystem.Write(fileName, buffer.String())
+	rows, err := seriesRows(buckets, size)
 
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return nil
+	return a.exportRows(path, seriesColumns(), 1, rows, options.Output)
 }
 
-func (a *ApiGatewayLogService) writeLogsToFile(logs []*apigateway.Log, w *csv.Writer, fileName string, buffer *bytes.Buffer) error {
-	values := getValuesFromLogs(logs)
+// ExportStatusMetrics breaks down the responses of a service by consumer, or
+// of a consumer by service, with a total row at the end.
+func (a *ApiGatewayLogService) ExportStatusMetrics(group string, id string, options apigateway.ExportOptions) (string, error) {
+	var get func(id string, period apigateway.TimeRange, limit int) *repository.Cursor
+	var key func(l *apigateway.Log) string
+	var counterpart string
+
+	switch group {
+	case apigateway.GroupByService:
+		get = a.repo.GetByService
+		key = func(l *apigateway.Log) string { return l.ConsumerID }
+		counterpart = apigateway.GroupByConsumer
+	case apigateway.GroupByConsumer:
+		get = a.repo.GetByConsumer
+		key = func(l *apigateway.Log) string { return l.ServiceID }
+		counterpart = apigateway.GroupByService
+	default:
+		return "", ErrUnknownGroup
+	}
 
-	err := w.WriteAll(values)
+	path, err := a.outputPath("status-"+group, id, options.Output)
 
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	err = a.filesystem.Write(fileName, buffer.String())
+	total := newStatusMetrics()
+	groups := map[string]*statusMetrics{}
 
-	if err != nil {
-		return err
+	cursor := get(id, options.Range, itemsPerPage)
+
+	for {
+		logs, err := cursor.Next()
+
+		if err != nil {
+			return "", err
+		}
+
+		if logs == nil {
+			break
+		}
+
+		for _, l := range logs {
+			s, ok := groups[key(l)]
+
+			if !ok {
+				s = newStatusMetrics()
+				groups[key(l)] = s
+			}
+
+			s.add(l)
+			total.add(l)
+		}
 	}
 
-	buffer.Reset()
-	return nil
+	codes := total.statusCodes()
+
+	var rows [][]string
+
+	for k, s := range groups {
+		rows = append(rows, append([]string{k}, s.values(codes)...))
+	}
+
+	sortRows(rows, 0, false)
+
+	rows = append(rows, append([]string{"total"}, total.values(codes)...))
+
+	return a.exportRows(path, statusColumns(counterpart, codes), 1, rows, options.Output)
 }
 
-func (a *ApiGatewayLogService) addLogs(logs []*apigateway.Log, wg *sync.WaitGroup) {
-	err := a.repo.Add(logs...)
+// Top ranks the entities by the metric, highest first, keeping the first
+// options.Limit of them.
+func (a *ApiGatewayLogService) Top(options apigateway.TopOptions) (string, error) {
+	path, err := a.outputPath("top-"+options.By, options.Metric, options.Output)
+
+	if err != nil {
+		return "", err
+	}
+
+	entity, ok := topEntities[options.By]
+
+	if !ok {
+		return "", ErrUnknownEntity
+	}
+
+	columns := append([]string{options.By, "name"}, topMetricColumns...)
+
+	metricIndex, err := columnIndex(topMetricColumns, options.Metric)
+
 	if err != nil {
-		log.Fatal(err)
+		return "", ErrUnknownMetric
+	}
+
+	limit := options.Limit
+
+	if limit <= 0 {
+		limit = defaultTopLimit
+	}
+
+	entities := map[string]*topMetrics{}
+
+	cursor := a.repo.GetAll(options.Range, itemsPerPage)
+
+	for {
+		logs, err := cursor.Next()
+
+		if err != nil {
+			return "", err
+		}
+
+		if logs == nil {
+			break
+		}
+
+		for _, l := range logs {
+			key, name := entity(l)
+
+			t, ok := entities[key]
+
+			if !ok {
+				t = newTopMetrics()
+				entities[key] = t
+			}
+
+			t.add(l, name)
+		}
+	}
+
+	var rows [][]string
+
+	for key, t := range entities {
+		rows = append(rows, append([]string{key, t.name}, t.values()...))
+	}
+
+	sortRows(rows, 2+metricIndex, true)
+
+	if len(rows) > limit {
+		rows = rows[:limit]
 	}
 
+	return a.exportRows(path, columns, 2, rows, options.Output)
+}
+
+func writeLogs(logs []*apigateway.Log, toSlice func(l *apigateway.Log) []string, exp exporter.Exporter) error {
+	for _, values := range getValuesFromLogs(logs, toSlice) {
+		err := exp.Write(values)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *ApiGatewayLogService) writeBatches(ctx context.Context, batches <-chan batch, tracker *checkpointTracker, counts *writeCounts, fail func(error), wg *sync.WaitGroup) {
 	defer wg.Done()
+
+	for b := range batches {
+		if ctx.Err() != nil {
+			continue
+		}
+
+		added, err := a.addLogs(b.logs)
+		if err == nil {
+			counts.add(len(b.logs), added)
+			err = tracker.ack(b.seq, b.offset, b.line)
+		}
+
+		if err != nil {
+			fail(err)
+		}
+	}
 }
 
-func (a *ApiGatewayLogService) writeColumns(w *csv.Writer, fileName string, buffer *bytes.Buffer) error {
-	columns := apigateway.GetJsonFieldsFromLogStruct()
-	separator := ';'
-	w.Comma = separator
-	err := w.WriteAll([][]string{columns})
+func (a *ApiGatewayLogService) addLogs(logs []*apigateway.Log) (int, error) {
+	return a.repo.Add(logs...)
+}
 
-	if err != nil {
+func skip(r io.Reader, offset int64) error {
+	if seeker, ok := r.(io.Seeker); ok {
+		_, err := seeker.Seek(offset, io.SeekStart)
 		return err
 	}
 
-	err = a.filesystem.Write(fileName, buffer.String())
+	_, err := io.CopyN(ioutil.Discard, r, offset)
+	return err
+}
+
+func isParseArtifact(path string) bool {
+	return strings.HasSuffix(path, ".checkpoint") ||
+		strings.HasSuffix(path, ".rejected.jsonl") ||
+		strings.HasSuffix(path, ".tmp")
+}
+
+// outputPath resolves where an export is written: stdout, the file given or,
+// when a directory or nothing is given, a file on it named by the template.
+func (a *ApiGatewayLogService) outputPath(prefix string, id string, options apigateway.OutputOptions) (string, error) {
+	extension, err := exporter.Extension(options)
 
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	defer w.Flush()
-	defer buffer.Reset()
+	dir := options.Path
 
-	return nil
+	switch {
+	case dir == apigateway.Stdout:
+		return dir, nil
+	case dir == "":
+		dir = a.outputDir
+	case !strings.HasSuffix(dir, "/") && !a.filesystem.IsDir(dir):
+		return dir, nil
+	}
+
+	return filepath.Join(dir, generateFileName(options.FileName, prefix, id, extension)), nil
+}
+
+func generateFileName(template string, prefix string, id string, extension string) string {
+	if template == "" {
+		template = defaultFileName
+	}
+
+	return strings.NewReplacer(
+		"{prefix}", prefix,
+		"{id}", id,
+		"{date}", time.Now().Format("02-01-2006"),
+		"{ext}", extension,
+	).Replace(template)
 }
 
-func generateFileName(prefix string, id string) string {
-	rand.Seed(time.Now().UnixNano())
-	return fmt.Sprintf("/data/%s-%s-%s-%d.csv", prefix, id, time.Now().Format("02-01-2006"), rand.Uint32())
+// logColumns returns the header of the export and how each log is written:
+// only the columns chosen, in their order, or all of them with the nested
+// fields as JSON or flattened to their own columns.
+func logColumns(options apigateway.ExportOptions) ([]string, []apigateway.ColumnType, func(l *apigateway.Log) []string, error) {
+	if len(options.Columns) > 0 {
+		var getters []func(l *apigateway.Log) string
+		var types []apigateway.ColumnType
+
+		for _, column := range options.Columns {
+			get, columnType, err := apigateway.GetColumnFromLogStruct(column)
+
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			getters = append(getters, get)
+			types = append(types, columnType)
+		}
+
+		return options.Columns, types, func(l *apigateway.Log) []string {
+			values := make([]string, len(getters))
+
+			for i, get := range getters {
+				values[i] = get(l)
+			}
+
+			return values
+		}, nil
+	}
+
+	if options.Flatten {
+		return apigateway.GetFlatJsonFieldsFromLogStruct(), apigateway.GetFlatJsonTypesFromLogStruct(), (*apigateway.Log).ToFlatSlice, nil
+	}
+
+	return apigateway.GetJsonFieldsFromLogStruct(), apigateway.GetJsonTypesFromLogStruct(), (*apigateway.Log).ToSlice, nil
 }
 
-func getValuesFromLogs(logs []*apigateway.Log) [][]string {
+func getValuesFromLogs(logs []*apigateway.Log, toSlice func(l *apigateway.Log) []string) [][]string {
 	var values [][]string
 	for _, l := range logs {
-		r := l.ToSlice()
+		r := toSlice(l)
 
 		values = append(values, r)
 	}
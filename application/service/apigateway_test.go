@@ -2,6 +2,8 @@ package service
 
 import (
 	"api-gateway-log-parser/pkg/apigateway"
+	"api-gateway-log-parser/pkg/exporter"
+	mock "api-gateway-log-parser/test/mocks"
 	"fmt"
 	as "github.com/stretchr/testify/assert"
 	"testing"
@@ -46,7 +48,7 @@ func TestApiGatewayLogService_ShouldGetValuesFromLogs(t *testing.T) {
 		ConsumerID:          consumerID,
 	})
 
-	values := getValuesFromLogs(logs)
+	values := getValuesFromLogs(logs, (*apigateway.Log).ToSlice)
 
 	authenticatedEntityJson := fmt.Sprintf(`{"consumer_id":{"uuid":"%s"}}`, consumerID)
 
@@ -65,7 +67,7 @@ func TestApiGatewayLogService_ShouldGetEmptyValuesFromLogs(t *testing.T) {
 
 	var logs []*apigateway.Log
 
-	values := getValuesFromLogs(logs)
+	values := getValuesFromLogs(logs, (*apigateway.Log).ToSlice)
 
 	assert.Len(values, 0)
 }
@@ -76,9 +78,47 @@ func TestApiGatewayLogService_ShouldReturnFileName(t *testing.T) {
 	day := time.Now().Format("02-01-2006")
 
 	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
-	fileName := generateFileName("service", serviceID)
+	fileName := generateFileName("", "service", serviceID, apigateway.FormatCSV)
 
-	assert.Contains(fileName, serviceID)
-	assert.Contains(fileName, "service")
-	assert.Contains(fileName, day)
+	assert.Equal("service-"+serviceID+"-"+day+".csv", fileName)
+	assert.Equal(fileName, generateFileName("", "service", serviceID, apigateway.FormatCSV))
+
+	fileName = generateFileName("{id}_{prefix}.{ext}", "service", serviceID, apigateway.FormatJSONLines)
+
+	assert.Equal(serviceID+"_service.jsonl", fileName)
+}
+
+func TestApiGatewayLogService_ShouldResolveOutputPath(t *testing.T) {
+	assert := as.New(t)
+
+	filesystem := mock.FileSystemMock{}
+	filesystem.On("IsDir", "exports").Return(true)
+	filesystem.On("IsDir", "exports/logs.csv").Return(false)
+
+	service, _ := NewApiGatewayLogParserService(nil, &filesystem, WithOutputDir("/data"))
+
+	options := apigateway.OutputOptions{FileName: "{prefix}-{id}.{ext}"}
+
+	paths := map[string]string{
+		"":                 "/data/service-id.csv",
+		"-":                "-",
+		"exports":          "exports/service-id.csv",
+		"missing/":         "missing/service-id.csv",
+		"exports/logs.csv": "exports/logs.csv",
+	}
+
+	for output, expected := range paths {
+		options.Path = output
+
+		path, err := service.outputPath("service", "id", options)
+
+		assert.Nil(err)
+		assert.Equal(expected, path, output)
+	}
+
+	options.Format = "xml"
+
+	_, err := service.outputPath("service", "id", options)
+
+	assert.Same(exporter.ErrUnknownFormat, err)
 }
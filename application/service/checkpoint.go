@@ -0,0 +1,126 @@
+package service
+
+import (
+	"api-gateway-log-parser/pkg/filesystem"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+)
+
+var ErrCheckpointDoesNotMatchFile = errors.New("checkpoint does not match the file, it was probably replaced since the last parse")
+
+type checkpoint struct {
+	Path        string `json:"path"`
+	Fingerprint string `json:"fingerprint"`
+	Offset      int64  `json:"offset"`
+	Line        int    `json:"line"`
+	Completed   bool   `json:"completed,omitempty"`
+}
+
+func checkpointPath(path string) string {
+	return path + ".checkpoint"
+}
+
+func readCheckpoint(fs filesystem.API, path string, fingerprint string) (checkpoint, error) {
+	data, err := fs.Read(checkpointPath(path))
+
+	if os.IsNotExist(err) {
+		return checkpoint{Path: path, Fingerprint: fingerprint}, nil
+	}
+
+	if err != nil {
+		return checkpoint{}, err
+	}
+
+	var c checkpoint
+
+	err = json.Unmarshal([]byte(data), &c)
+
+	if err != nil {
+		return checkpoint{}, err
+	}
+
+	if c.Fingerprint != fingerprint {
+		return checkpoint{}, ErrCheckpointDoesNotMatchFile
+	}
+
+	return c, nil
+}
+
+// checkpointTracker commits the position of a batch only once every batch
+// read before it was written, since the writers acknowledge them out of order.
+type checkpointTracker struct {
+	fs      filesystem.API
+	current checkpoint
+	next    int
+	acked   map[int]checkpoint
+	mutex   sync.Mutex
+}
+
+func newCheckpointTracker(fs filesystem.API, start checkpoint) *checkpointTracker {
+	return &checkpointTracker{
+		fs:      fs,
+		current: start,
+		acked:   map[int]checkpoint{},
+	}
+}
+
+func (t *checkpointTracker) ack(seq int, offset int64, line int) error {
+	if t == nil {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	c := t.current
+	c.Offset = offset
+	c.Line = line
+
+	t.acked[seq] = c
+
+	advanced := false
+
+	for {
+		c, ok := t.acked[t.next]
+		if !ok {
+			break
+		}
+
+		delete(t.acked, t.next)
+
+		t.current = c
+		t.next++
+		advanced = true
+	}
+
+	if !advanced {
+		return nil
+	}
+
+	return t.write(t.current)
+}
+
+func (t *checkpointTracker) write(c checkpoint) error {
+	data, err := json.Marshal(c)
+
+	if err != nil {
+		return err
+	}
+
+	return t.fs.Replace(checkpointPath(c.Path), string(data))
+}
+
+func (t *checkpointTracker) complete() error {
+	if t == nil {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.current.Completed = true
+
+	return t.write(t.current)
+}
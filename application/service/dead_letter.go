@@ -0,0 +1,91 @@
+package service
+
+import (
+	"api-gateway-log-parser/pkg/filesystem"
+	"encoding/json"
+	"io"
+)
+
+type rejectedLine struct {
+	Path  string `json:"path"`
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+	Data  string `json:"data"`
+}
+
+// deadLetters keeps the dead-letter files of a parse open until it ends. A
+// file shared by the parsed files, as with --dead-letter, is emptied once, on
+// its first file, unless the parse resumes.
+type deadLetters struct {
+	filesystem filesystem.API
+	truncate   bool
+	writers    map[string]io.WriteCloser
+}
+
+func newDeadLetters(fs filesystem.API, resume bool) *deadLetters {
+	return &deadLetters{filesystem: fs, truncate: !resume, writers: map[string]io.WriteCloser{}}
+}
+
+func (d *deadLetters) open(path string) (io.Writer, error) {
+	if w, ok := d.writers[path]; ok {
+		return w, nil
+	}
+
+	w, err := d.filesystem.OpenWriter(path, d.truncate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d.writers[path] = w
+
+	return w, nil
+}
+
+func (d *deadLetters) reject(w io.Writer, path string, line int, data []byte, decodeErr error) error {
+	rejected, err := json.Marshal(rejectedLine{
+		Path:  path,
+		Line:  line,
+		Error: decodeErr.Error(),
+		Data:  string(data),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(rejected, '\n'))
+
+	return err
+}
+
+func (d *deadLetters) close() error {
+	var err error
+
+	for _, w := range d.writers {
+		if closeErr := w.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// appendPath lists a dead-letter file once, even when shared by the files.
+func appendPath(paths []string, path string) []string {
+	for _, p := range paths {
+		if p == path {
+			return paths
+		}
+	}
+
+	return append(paths, path)
+}
+
+func deadLetterPath(path string) string {
+	if path == filesystem.Stdin {
+		return "stdin.rejected.jsonl"
+	}
+
+	return path + ".rejected.jsonl"
+}
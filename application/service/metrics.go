@@ -0,0 +1,428 @@
+package service
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"api-gateway-log-parser/pkg/apigateway/repository/driver"
+	"api-gateway-log-parser/pkg/metrics"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownSortColumn = errors.New("unknown column to sort by")
+	ErrInvalidBucket     = errors.New("bucket must be at least one millisecond")
+	ErrTooManyBuckets    = errors.New("too many buckets, use a larger bucket or a shorter time range")
+	ErrUnknownGroup      = errors.New("unknown group, must be service or consumer")
+	ErrUnknownEntity     = errors.New("unknown entity, must be route, service, consumer, client_ip or upstream_uri")
+	ErrUnknownMetric     = errors.New("unknown metric, must be requests, errors, response_bytes or request_p95")
+)
+
+// serverErrorStatus is the first status counted as an error on the series, as
+// 4xx are usually caused by the consumer and not by a degraded service.
+const serverErrorStatus = 500
+
+// maxSeriesBuckets bounds the rows of a series, which are all kept in memory,
+// empty buckets included.
+const maxSeriesBuckets = 100000
+
+// millisecondLayout is RFC3339 with milliseconds, for buckets that do not
+// start on a whole second.
+const millisecondLayout = "2006-01-02T15:04:05.000Z07:00"
+
+var (
+	latencyTypes = []string{"request", "proxy", "gateway"}
+	percentiles  = []struct {
+		name     string
+		quantile float64
+	}{
+		{"p50", 0.5},
+		{"p90", 0.9},
+		{"p95", 0.95},
+		{"p99", 0.99},
+	}
+)
+
+type latencyMetrics struct {
+	request *metrics.Histogram
+	proxy   *metrics.Histogram
+	gateway *metrics.Histogram
+}
+
+func newLatencyMetrics() *latencyMetrics {
+	return &latencyMetrics{
+		request: metrics.NewHistogram(),
+		proxy:   metrics.NewHistogram(),
+		gateway: metrics.NewHistogram(),
+	}
+}
+
+func (l *latencyMetrics) add(log *apigateway.Log) {
+	l.request.Record(int64(log.Latencies.Request))
+	l.proxy.Record(int64(log.Latencies.Proxy))
+	l.gateway.Record(int64(log.Latencies.Gateway))
+}
+
+func (l *latencyMetrics) count() uint64 {
+	return l.request.Count()
+}
+
+func (l *latencyMetrics) histograms() []*metrics.Histogram {
+	return []*metrics.Histogram{l.request, l.proxy, l.gateway}
+}
+
+// latencyColumns keeps the averages first, as they were the only metrics
+// exported before, followed by the distribution of each latency type.
+func latencyColumns() []string {
+	var columns []string
+
+	for _, latency := range latencyTypes {
+		columns = append(columns, latency+"_avg")
+	}
+
+	for _, latency := range latencyTypes {
+		columns = append(columns, latency+"_min", latency+"_max")
+
+		for _, p := range percentiles {
+			columns = append(columns, latency+"_"+p.name)
+		}
+	}
+
+	return columns
+}
+
+func (l *latencyMetrics) values() []string {
+	var values []string
+
+	for _, h := range l.histograms() {
+		values = append(values, fmt.Sprintf("%.2f", h.Mean()))
+	}
+
+	for _, h := range l.histograms() {
+		values = append(values, strconv.FormatInt(h.Min(), 10), strconv.FormatInt(h.Max(), 10))
+
+		for _, p := range percentiles {
+			values = append(values, strconv.FormatInt(h.Quantile(p.quantile), 10))
+		}
+	}
+
+	return values
+}
+
+func quantiles() []float64 {
+	var quantiles []float64
+
+	for _, p := range percentiles {
+		quantiles = append(quantiles, p.quantile)
+	}
+
+	return quantiles
+}
+
+// summaryValues are the values of a summary aggregated by the driver, on the
+// columns and the format of latencyMetrics.values.
+func summaryValues(summary driver.LatencySummary) []string {
+	var values []string
+
+	stats := []driver.LatencyStats{summary.Request, summary.Proxy, summary.Gateway}
+
+	for _, s := range stats {
+		values = append(values, fmt.Sprintf("%.2f", s.Avg))
+	}
+
+	for _, s := range stats {
+		values = append(values, strconv.FormatInt(s.Min, 10), strconv.FormatInt(s.Max, 10))
+
+		for _, q := range s.Quantiles {
+			values = append(values, strconv.FormatInt(q, 10))
+		}
+	}
+
+	return values
+}
+
+type serviceMetrics struct {
+	name      string
+	latencies *latencyMetrics
+}
+
+type bucketMetrics struct {
+	errors    uint64
+	latencies *latencyMetrics
+}
+
+func newBucketMetrics() *bucketMetrics {
+	return &bucketMetrics{latencies: newLatencyMetrics()}
+}
+
+func (b *bucketMetrics) add(log *apigateway.Log) {
+	if log.Response.Status >= serverErrorStatus {
+		b.errors++
+	}
+
+	b.latencies.add(log)
+}
+
+func seriesColumns() []string {
+	return append([]string{"bucket", "requests", "errors"}, latencyColumns()...)
+}
+
+// bucketCount is how many buckets of the size there are from the bucket of
+// the first time to the bucket of the last one.
+func bucketCount(first int64, last int64, size int64) int64 {
+	return (last-last%size)/size - (first-first%size)/size + 1
+}
+
+// seriesRows has a row for every bucket between the first and the last log,
+// the ones without logs included, so gaps on the traffic are not hidden.
+func seriesRows(buckets map[int64]*bucketMetrics, size int64) ([][]string, error) {
+	if len(buckets) == 0 {
+		return nil, nil
+	}
+
+	first, last := int64(math.MaxInt64), int64(math.MinInt64)
+
+	for start := range buckets {
+		if start < first {
+			first = start
+		}
+
+		if start > last {
+			last = start
+		}
+	}
+
+	if bucketCount(first, last, size) > maxSeriesBuckets {
+		return nil, ErrTooManyBuckets
+	}
+
+	layout := time.RFC3339
+	if size%1000 != 0 {
+		layout = millisecondLayout
+	}
+
+	empty := newBucketMetrics()
+
+	var rows [][]string
+
+	for start := first; start <= last; start += size {
+		b, ok := buckets[start]
+
+		if !ok {
+			b = empty
+		}
+
+		row := []string{
+			time.Unix(0, start*int64(time.Millisecond)).UTC().Format(layout),
+			strconv.FormatUint(b.latencies.count(), 10),
+			strconv.FormatUint(b.errors, 10),
+		}
+
+		rows = append(rows, append(row, b.latencies.values()...))
+	}
+
+	return rows, nil
+}
+
+var statusClasses = []string{"2xx", "3xx", "4xx", "5xx"}
+
+type statusMetrics struct {
+	requests uint64
+	classes  map[string]uint64
+	codes    map[int]uint64
+}
+
+func newStatusMetrics() *statusMetrics {
+	return &statusMetrics{
+		classes: map[string]uint64{},
+		codes:   map[int]uint64{},
+	}
+}
+
+func (s *statusMetrics) add(log *apigateway.Log) {
+	s.requests++
+	s.classes[fmt.Sprintf("%dxx", log.Response.Status/100)]++
+	s.codes[log.Response.Status]++
+}
+
+func (s *statusMetrics) rate(class string) string {
+	if s.requests == 0 {
+		return "0.00"
+	}
+
+	return fmt.Sprintf("%.2f", float64(s.classes[class])*100/float64(s.requests))
+}
+
+// statusColumns has the status classes and error rates, followed by a column
+// for each status code given.
+func statusColumns(group string, codes []int) []string {
+	columns := []string{group, "requests"}
+	columns = append(columns, statusClasses...)
+	columns = append(columns, "client_error_rate", "server_error_rate")
+
+	for _, code := range codes {
+		columns = append(columns, "status_"+strconv.Itoa(code))
+	}
+
+	return columns
+}
+
+func (s *statusMetrics) values(codes []int) []string {
+	values := []string{strconv.FormatUint(s.requests, 10)}
+
+	for _, class := range statusClasses {
+		values = append(values, strconv.FormatUint(s.classes[class], 10))
+	}
+
+	values = append(values, s.rate("4xx"), s.rate("5xx"))
+
+	for _, code := range codes {
+		values = append(values, strconv.FormatUint(s.codes[code], 10))
+	}
+
+	return values
+}
+
+func (s *statusMetrics) statusCodes() []int {
+	var codes []int
+
+	for code := range s.codes {
+		codes = append(codes, code)
+	}
+
+	sort.Ints(codes)
+
+	return codes
+}
+
+// usageMetrics are the metrics of what a consumer called, the bytes sent are
+// the size of its requests and the bytes received of the responses.
+type usageMetrics struct {
+	bytesSent     int64
+	bytesReceived int64
+	latencies     *latencyMetrics
+}
+
+func newUsageMetrics() *usageMetrics {
+	return &usageMetrics{latencies: newLatencyMetrics()}
+}
+
+func (u *usageMetrics) add(log *apigateway.Log) {
+	u.bytesSent += int64(log.Request.Size)
+	u.bytesReceived += int64(log.Response.Size)
+	u.latencies.add(log)
+}
+
+func usageColumns() []string {
+	return append([]string{"consumer", "service", "requests", "bytes_sent", "bytes_received"}, latencyColumns()...)
+}
+
+func (u *usageMetrics) values() []string {
+	values := []string{
+		strconv.FormatUint(u.latencies.count(), 10),
+		strconv.FormatInt(u.bytesSent, 10),
+		strconv.FormatInt(u.bytesReceived, 10),
+	}
+
+	return append(values, u.latencies.values()...)
+}
+
+const defaultTopLimit = 10
+
+// topEntities are what the top report can rank, each one with the key it is
+// grouped by and a readable name, when the log has one.
+var topEntities = map[string]func(l *apigateway.Log) (string, string){
+	"route": func(l *apigateway.Log) (string, string) {
+		return l.Route.ID, strings.Join(l.Route.Paths, ",")
+	},
+	"service": func(l *apigateway.Log) (string, string) {
+		return l.ServiceID, l.Service.Name
+	},
+	"consumer": func(l *apigateway.Log) (string, string) {
+		return l.ConsumerID, ""
+	},
+	"client_ip": func(l *apigateway.Log) (string, string) {
+		return l.ClientIP, ""
+	},
+	"upstream_uri": func(l *apigateway.Log) (string, string) {
+		return l.UpstreamURI, ""
+	},
+}
+
+var topMetricColumns = []string{"requests", "errors", "response_bytes", "request_p95"}
+
+type topMetrics struct {
+	name          string
+	errors        uint64
+	responseBytes int64
+	request       *metrics.Histogram
+}
+
+func newTopMetrics() *topMetrics {
+	return &topMetrics{request: metrics.NewHistogram()}
+}
+
+func (t *topMetrics) add(log *apigateway.Log, name string) {
+	if name != "" {
+		t.name = name
+	}
+
+	if log.Response.Status >= serverErrorStatus {
+		t.errors++
+	}
+
+	t.responseBytes += int64(log.Response.Size)
+	t.request.Record(int64(log.Latencies.Request))
+}
+
+func (t *topMetrics) values() []string {
+	return []string{
+		strconv.FormatUint(t.request.Count(), 10),
+		strconv.FormatUint(t.errors, 10),
+		strconv.FormatInt(t.responseBytes, 10),
+		strconv.FormatInt(t.request.Quantile(0.95), 10),
+	}
+}
+
+func columnIndex(columns []string, column string) (int, error) {
+	for i, c := range columns {
+		if c == column {
+			return i, nil
+		}
+	}
+
+	return -1, ErrUnknownSortColumn
+}
+
+// sortRows sorts by the values of the column as numbers when both are, and as
+// text otherwise, keeping the order of the first column on ties.
+func sortRows(rows [][]string, index int, descending bool) {
+	less := func(a, b string) bool {
+		x, errX := strconv.ParseFloat(a, 64)
+		y, errY := strconv.ParseFloat(b, 64)
+
+		if errX == nil && errY == nil {
+			return x < y
+		}
+
+		return a < b
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i][index], rows[j][index]
+
+		if a == b {
+			return rows[i][0] < rows[j][0]
+		}
+
+		if descending {
+			return less(b, a)
+		}
+
+		return less(a, b)
+	})
+}
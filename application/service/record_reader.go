@@ -0,0 +1,127 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+const (
+	defaultMaxLineSize = 1024 * 1024
+	readerBufferSize   = 64 * 1024
+)
+
+var (
+	ErrLineTooLong = errors.New("line is longer than the max line size")
+	ErrEmptyLine   = errors.New("empty line")
+)
+
+type recordReader interface {
+	Next() ([]byte, error)
+	Offset() int64
+}
+
+// lineReader reads one record per line. Unlike bufio.Scanner it does not stop
+// on a line longer than maxSize: the line is skipped and ErrLineTooLong is
+// returned with its beginning, so the caller decides what to do with it.
+type lineReader struct {
+	reader  *bufio.Reader
+	maxSize int
+	offset  int64
+}
+
+func newLineReader(r io.Reader, offset int64, maxSize int) *lineReader {
+	if maxSize <= 0 {
+		maxSize = defaultMaxLineSize
+	}
+
+	return &lineReader{
+		reader:  bufio.NewReaderSize(r, readerBufferSize),
+		maxSize: maxSize,
+		offset:  offset,
+	}
+}
+
+func (l *lineReader) Next() ([]byte, error) {
+	var line []byte
+
+	read := 0
+	tooLong := false
+
+	for {
+		chunk, err := l.reader.ReadSlice('\n')
+
+		read += len(chunk)
+		l.offset += int64(len(chunk))
+
+		if !tooLong {
+			line = append(line, chunk...)
+
+			if len(trimLineEnd(line)) > l.maxSize {
+				line = line[:l.maxSize]
+				tooLong = true
+			}
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+
+		if err == io.EOF && read == 0 {
+			return nil, io.EOF
+		}
+
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		break
+	}
+
+	if tooLong {
+		return line, ErrLineTooLong
+	}
+
+	return trimLineEnd(line), nil
+}
+
+func (l *lineReader) Offset() int64 {
+	return l.offset
+}
+
+func trimLineEnd(line []byte) []byte {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r"))
+}
+
+// jsonStreamReader reads one record per JSON value, whatever the line breaks
+// inside or between them, so records of any size are decoded.
+type jsonStreamReader struct {
+	decoder *json.Decoder
+	start   int64
+}
+
+func newJsonStreamReader(r io.Reader, offset int64) *jsonStreamReader {
+	return &jsonStreamReader{
+		decoder: json.NewDecoder(r),
+		start:   offset,
+	}
+}
+
+func (j *jsonStreamReader) Next() ([]byte, error) {
+	var raw json.RawMessage
+
+	err := j.decoder.Decode(&raw)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return raw, nil
+}
+
+func (j *jsonStreamReader) Offset() int64 {
+	return j.start + j.decoder.InputOffset()
+}
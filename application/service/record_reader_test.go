@@ -0,0 +1,93 @@
+package service
+
+import (
+	"bytes"
+	as "github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLineReader_ShouldReadLinesAndOffsets(t *testing.T) {
+	assert := as.New(t)
+
+	r := newLineReader(strings.NewReader("first\r\n\nsecond\nlast"), 0, 0)
+
+	line, err := r.Next()
+	assert.Nil(err)
+	assert.Equal("first", string(line))
+	assert.EqualValues(7, r.Offset())
+
+	line, err = r.Next()
+	assert.Nil(err)
+	assert.Equal("", string(line))
+	assert.EqualValues(8, r.Offset())
+
+	line, err = r.Next()
+	assert.Nil(err)
+	assert.Equal("second", string(line))
+
+	line, err = r.Next()
+	assert.Nil(err)
+	assert.Equal("last", string(line))
+	assert.EqualValues(19, r.Offset())
+
+	_, err = r.Next()
+	assert.Equal(io.EOF, err)
+}
+
+func TestLineReader_ShouldSkipLinesLongerThanMaxSize(t *testing.T) {
+	assert := as.New(t)
+
+	long := strings.Repeat("a", readerBufferSize*3)
+
+	r := newLineReader(strings.NewReader("short\n"+long+"\nnext\n"), 0, readerBufferSize)
+
+	line, err := r.Next()
+	assert.Nil(err)
+	assert.Equal("short", string(line))
+
+	line, err = r.Next()
+	assert.Same(ErrLineTooLong, err)
+	assert.Len(line, readerBufferSize)
+
+	line, err = r.Next()
+	assert.Nil(err)
+	assert.Equal("next", string(line))
+	assert.EqualValues(len("short\n"+long+"\nnext\n"), r.Offset())
+}
+
+func TestLineReader_ShouldReadLinesLongerThanBuffer(t *testing.T) {
+	assert := as.New(t)
+
+	long := strings.Repeat("a", readerBufferSize*3)
+
+	r := newLineReader(strings.NewReader(long+"\n"), 0, 0)
+
+	line, err := r.Next()
+	assert.Nil(err)
+	assert.Equal(long, string(line))
+}
+
+func TestJsonStreamReader_ShouldReadValuesAcrossLines(t *testing.T) {
+	assert := as.New(t)
+
+	input := "{\n  \"started_at\": 1\n}\n{\"started_at\": 2} {\"started_at\": 3}"
+
+	r := newJsonStreamReader(strings.NewReader(input), 10)
+
+	var records []string
+
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+
+		assert.Nil(err)
+		records = append(records, string(bytes.Join(bytes.Fields(record), nil)))
+	}
+
+	assert.Equal([]string{`{"started_at":1}`, `{"started_at":2}`, `{"started_at":3}`}, records)
+	assert.EqualValues(10+len(input), r.Offset())
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"api-gateway-log-parser/internal/di"
+	"errors"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"log"
 )
@@ -20,7 +22,13 @@ func main() {
 		log.Fatal(err)
 	}
 
-	dbSvc := d.Client().(*dynamodb.DynamoDB)
+	// The other drivers create their tables themselves.
+	dbSvc, ok := d.Client().(*dynamodb.DynamoDB)
+
+	if !ok {
+		log.Println("not a dynamodb table, nothing to create")
+		return
+	}
 
 	log.Println("creating table")
 	params := &dynamodb.CreateTableInput{
@@ -35,8 +43,8 @@ func main() {
 				AttributeType: aws.String("S"),
 			},
 			{
-				AttributeName: aws.String("started_at"),
-				AttributeType: aws.String("N"),
+				AttributeName: aws.String("sort_key"),
+				AttributeType: aws.String("S"),
 			},
 		},
 		KeySchema: []*dynamodb.KeySchemaElement{
@@ -45,7 +53,7 @@ func main() {
 				KeyType:       aws.String("HASH"),
 			},
 			{
-				AttributeName: aws.String("started_at"),
+				AttributeName: aws.String("sort_key"),
 				KeyType:       aws.String("RANGE"),
 			},
 		},
@@ -59,7 +67,7 @@ func main() {
 						KeyType:       aws.String("HASH"),
 					},
 					{
-						AttributeName: aws.String("started_at"),
+						AttributeName: aws.String("sort_key"),
 						KeyType:       aws.String("RANGE"),
 					},
 				},
@@ -72,9 +80,36 @@ func main() {
 
 	_, err = dbSvc.CreateTable(params)
 
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == dynamodb.ErrCodeResourceInUseException {
+		checkKey(dbSvc, d.GetTableName())
+		log.Println("table already exists")
+		return
+	}
+
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	log.Println("table created successfully")
 }
+
+// checkKey fails when the existing table is still keyed by started_at, as
+// logs of the same millisecond would overwrite each other and queries by
+// sort_key would fail.
+func checkKey(dbSvc *dynamodb.DynamoDB, tableName string) {
+	output, err := dbSvc.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(tableName)})
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, key := range output.Table.KeySchema {
+		if aws.StringValue(key.KeyType) == dynamodb.KeyTypeRange && aws.StringValue(key.AttributeName) == "sort_key" {
+			return
+		}
+	}
+
+	log.Fatalf("table %s is not keyed by sort_key, set API_GATEWAY_LOGS_TABLE_NAME_TABLE to a new table "+
+		"and API_GATEWAY_LOGS_SOURCE_TABLE to %s to copy its logs with migrate_logs_key", tableName, tableName)
+}
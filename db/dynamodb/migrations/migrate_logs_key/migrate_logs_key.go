@@ -0,0 +1,84 @@
+package main
+
+import (
+	"api-gateway-log-parser/internal/di"
+	"api-gateway-log-parser/pkg/apigateway"
+	"api-gateway-log-parser/pkg/apigateway/repository"
+	"api-gateway-log-parser/pkg/apigateway/repository/driver"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"log"
+	"os"
+)
+
+const pageSize = 1000
+
+// Tables created before the logs had an ID were keyed by service_id and
+// started_at, so this copies their logs to the table keyed by sort_key.
+var sourceTableName = os.Getenv("API_GATEWAY_LOGS_SOURCE_TABLE")
+
+var container *di.Container
+
+func init() {
+	container = di.NewContainer()
+}
+
+func main() {
+	if sourceTableName == "" {
+		log.Println("no source table to copy the logs from")
+		return
+	}
+
+	d, err := container.GetApiGatewayLogDriver()
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client, ok := d.Client().(*dynamodb.DynamoDB)
+
+	if !ok {
+		log.Println("the source table is only read from dynamodb")
+		return
+	}
+
+	source, err := driver.NewDynamoDBDriver(sourceTableName, client, "")
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	target := container.MustGetApiGatewayLogRepository()
+	cursor := repository.NewApiGatewayLogRepository(source).GetAll(apigateway.TimeRange{}, pageSize)
+
+	copied := 0
+
+	log.Printf("copying logs from %s to %s", sourceTableName, d.GetTableName())
+
+	for {
+		logs, err := cursor.Next()
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if logs == nil {
+			break
+		}
+
+		// The logs are identified by their fields, like when parsed, so
+		// parsing their files again finds them already stored.
+		for _, l := range logs {
+			if l.ID == "" {
+				l.ID = apigateway.NewLogID(l)
+			}
+		}
+
+		if _, err = target.Add(logs...); err != nil {
+			log.Fatal(err)
+		}
+
+		copied += len(logs)
+	}
+
+	log.Printf("%d logs copied", copied)
+}
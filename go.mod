@@ -4,5 +4,10 @@ go 1.15
 
 require (
 	github.com/aws/aws-sdk-go v1.37.26
+	github.com/klauspost/compress v1.13.6
+	github.com/lib/pq v1.10.0
 	github.com/stretchr/testify v1.7.0
+	github.com/xitongsys/parquet-go v1.5.4
+	github.com/xitongsys/parquet-go-source v0.0.0-20200817004010-026bad9b25d0
+	modernc.org/sqlite v1.10.6
 )
@@ -8,8 +8,10 @@ import (
 	"api-gateway-log-parser/pkg/apigateway/repository/driver"
 	"api-gateway-log-parser/pkg/filesystem"
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
 )
 
 var (
@@ -17,15 +19,40 @@ var (
 	dynamoURL               = os.Getenv("DYNAMODB_URL")
 	dynamoRegion            = os.Getenv("DYNAMODB_REGION")
 	consumerIndex           = os.Getenv("DYNAMODB_CONSUMER_INDEX")
+	dynamoMaxRetries        = os.Getenv("DYNAMODB_MAX_RETRIES")
+	parserWorkers           = os.Getenv("PARSER_WORKERS")
+	exportDir               = os.Getenv("EXPORT_DIR")
+	logDriver               = os.Getenv("LOG_DRIVER")
+	sqlitePath              = os.Getenv("SQLITE_PATH")
+	postgresDSN             = os.Getenv("POSTGRES_DSN")
 )
 
+const (
+	DriverDynamoDB = "dynamodb"
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+)
+
+const (
+	defaultSQLitePath = "apigateway-logs.db"
+	defaultTableName  = "apigateway-logs"
+)
+
+var ErrUnknownDriver = errors.New("unknown log driver")
+
 type Container struct {
-	logParserHandler              func(c context.Context) error
-	exportByServiceHandler        func(c context.Context) error
-	exportByConsumerHandler       func(c context.Context) error
-	exportMetricsByServiceHandler func(c context.Context) error
-	apiGatewayRepository          *repository.ApiGatewayLogRepository
-	apiGatewayLogService          *service.ApiGatewayLogService
+	logParserHandler                func(c context.Context) error
+	exportByServiceHandler          func(c context.Context) error
+	exportByConsumerHandler         func(c context.Context) error
+	exportMetricsByServiceHandler   func(c context.Context) error
+	exportMetricsByConsumerHandler  func(c context.Context) error
+	exportMetricsAllServicesHandler func(c context.Context) error
+	exportMetricsSeriesHandler      func(c context.Context) error
+	exportStatusMetricsHandler      func(c context.Context) error
+	topHandler                      func(c context.Context) error
+	apiGatewayRepository            *repository.ApiGatewayLogRepository
+	apiGatewayLogService            *service.ApiGatewayLogService
 }
 
 func NewContainer() *Container {
@@ -42,7 +69,7 @@ func (c *Container) GetLogParserHandler() func(c context.Context) error {
 
 func (c *Container) GetExportByServiceHandler() func(c context.Context) error {
 	if c.exportByServiceHandler == nil {
-		c.exportByServiceHandler = handler.NewExportByServiceHandler(c.MustGetApiGatewayLogService()).HandleExportByService
+		c.exportByServiceHandler = handler.NewExportByServiceHandler(c.storedService, c.ephemeral()).HandleExportByService
 	}
 
 	return c.exportByServiceHandler
@@ -50,15 +77,55 @@ func (c *Container) GetExportByServiceHandler() func(c context.Context) error {
 
 func (c *Container) GetExportMetricsByServiceHandler() func(c context.Context) error {
 	if c.exportMetricsByServiceHandler == nil {
-		c.exportMetricsByServiceHandler = handler.NewExportMetricsByServiceHandler(c.MustGetApiGatewayLogService()).HandleExportMetricsByService
+		c.exportMetricsByServiceHandler = handler.NewExportMetricsByServiceHandler(c.storedService, c.ephemeral()).HandleExportMetricsByService
 	}
 
 	return c.exportMetricsByServiceHandler
 }
 
+func (c *Container) GetExportMetricsByConsumerHandler() func(c context.Context) error {
+	if c.exportMetricsByConsumerHandler == nil {
+		c.exportMetricsByConsumerHandler = handler.NewExportMetricsByConsumerHandler(c.storedService, c.ephemeral()).HandleExportMetricsByConsumer
+	}
+
+	return c.exportMetricsByConsumerHandler
+}
+
+func (c *Container) GetExportMetricsAllServicesHandler() func(c context.Context) error {
+	if c.exportMetricsAllServicesHandler == nil {
+		c.exportMetricsAllServicesHandler = handler.NewExportMetricsAllServicesHandler(c.storedService, c.ephemeral()).HandleExportMetricsAllServices
+	}
+
+	return c.exportMetricsAllServicesHandler
+}
+
+func (c *Container) GetExportMetricsSeriesHandler() func(c context.Context) error {
+	if c.exportMetricsSeriesHandler == nil {
+		c.exportMetricsSeriesHandler = handler.NewExportMetricsSeriesHandler(c.storedService, c.ephemeral()).HandleExportMetricsSeries
+	}
+
+	return c.exportMetricsSeriesHandler
+}
+
+func (c *Container) GetExportStatusMetricsHandler() func(c context.Context) error {
+	if c.exportStatusMetricsHandler == nil {
+		c.exportStatusMetricsHandler = handler.NewExportStatusMetricsHandler(c.storedService, c.ephemeral()).HandleExportStatusMetrics
+	}
+
+	return c.exportStatusMetricsHandler
+}
+
+func (c *Container) GetTopHandler() func(c context.Context) error {
+	if c.topHandler == nil {
+		c.topHandler = handler.NewTopHandler(c.storedService, c.ephemeral()).HandleTop
+	}
+
+	return c.topHandler
+}
+
 func (c *Container) GetExportByConsumerHandler() func(c context.Context) error {
 	if c.exportByConsumerHandler == nil {
-		c.exportByConsumerHandler = handler.NewExportByConsumerHandler(c.MustGetApiGatewayLogService()).HandleExportByConsumer
+		c.exportByConsumerHandler = handler.NewExportByConsumerHandler(c.storedService, c.ephemeral()).HandleExportByConsumer
 	}
 
 	return c.exportByConsumerHandler
@@ -75,9 +142,12 @@ func (c *Container) MustGetApiGatewayLogService() apigateway.LogService {
 
 func (c *Container) GetApiGatewayLogService() (*service.ApiGatewayLogService, error) {
 	if c.apiGatewayLogService == nil {
-		f := filesystem.NewLocalFileSystem()
+		repo, err := c.GetApiGatewayLogRepository()
+		if err != nil {
+			return nil, err
+		}
 
-		s, err := service.NewApiGatewayLogParserService(c.MustGetApiGatewayLogRepository(), f)
+		s, err := newApiGatewayLogService(repo)
 		if err != nil {
 			return nil, err
 		}
@@ -88,6 +158,38 @@ func (c *Container) GetApiGatewayLogService() (*service.ApiGatewayLogService, er
 	return c.apiGatewayLogService, nil
 }
 
+// GetEphemeralLogService is a new service that keeps its logs on memory, for
+// the runs that export the logs they have just parsed.
+func (c *Container) GetEphemeralLogService() (apigateway.LogService, error) {
+	d, err := driver.NewMemoryDriver(tableName())
+	if err != nil {
+		return nil, err
+	}
+
+	return newApiGatewayLogService(repository.NewApiGatewayLogRepository(d))
+}
+
+// storedService is the service of the stored logs, which the export handlers
+// only build when the run is not --ephemeral, as it opens the database.
+func (c *Container) storedService() (apigateway.LogService, error) {
+	return c.GetApiGatewayLogService()
+}
+
+func (c *Container) ephemeral() handler.Option {
+	return handler.WithEphemeralService(c.GetEphemeralLogService)
+}
+
+func newApiGatewayLogService(repo *repository.ApiGatewayLogRepository) (*service.ApiGatewayLogService, error) {
+	workers, _ := strconv.Atoi(parserWorkers)
+
+	return service.NewApiGatewayLogParserService(
+		repo,
+		filesystem.NewLocalFileSystem(),
+		service.WithWorkers(workers),
+		service.WithOutputDir(exportDir),
+	)
+}
+
 func (c *Container) MustGetApiGatewayLogRepository() *repository.ApiGatewayLogRepository {
 	repo, err := c.GetApiGatewayLogRepository()
 	if err != nil {
@@ -99,27 +201,70 @@ func (c *Container) MustGetApiGatewayLogRepository() *repository.ApiGatewayLogRe
 
 func (c *Container) GetApiGatewayLogRepository() (*repository.ApiGatewayLogRepository, error) {
 	if c.apiGatewayRepository == nil {
-
 		d, err := c.GetApiGatewayLogDriver()
-
-		c.apiGatewayRepository = repository.NewApiGatewayLogRepository(d)
-
 		if err != nil {
 			return nil, err
 		}
 
+		c.apiGatewayRepository = repository.NewApiGatewayLogRepository(d)
 	}
 
 	return c.apiGatewayRepository, nil
 }
 
+// GetApiGatewayLogDriver stores the logs on DynamoDB, unless LOG_DRIVER says
+// otherwise.
 func (c *Container) GetApiGatewayLogDriver() (driver.ApiGatewayLogDriver, error) {
+	switch logDriver {
+	case "", DriverDynamoDB:
+		return c.getDynamoDBDriver()
+	case DriverSQLite:
+		return c.getSQLiteDriver()
+	case DriverPostgres:
+		return driver.NewPostgresDriver(postgresDSN, tableName())
+	case DriverMemory:
+		return driver.NewMemoryDriver(tableName())
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDriver, logDriver)
+	}
+}
+
+func (c *Container) getSQLiteDriver() (driver.ApiGatewayLogDriver, error) {
+	path := sqlitePath
+	if path == "" {
+		path = defaultSQLitePath
+	}
+
+	return driver.NewSQLiteDriver(path, tableName())
+}
+
+// tableName is the table of the drivers other than DynamoDB, which are also
+// run without the .env file.
+func tableName() string {
+	if apiGatewayLogsTableName == "" {
+		return defaultTableName
+	}
+
+	return apiGatewayLogsTableName
+}
+
+func (c *Container) getDynamoDBDriver() (driver.ApiGatewayLogDriver, error) {
+	var options []driver.DynamoDBOption
+
+	if dynamoMaxRetries != "" {
+		maxRetries, err := strconv.Atoi(dynamoMaxRetries)
+		if err != nil {
+			return nil, err
+		}
+
+		options = append(options, driver.WithMaxRetries(maxRetries))
+	}
 
-	fmt.Println(dynamoURL, dynamoRegion)
 	d, err := driver.NewDynamoDBDriver(
 		apiGatewayLogsTableName,
 		driver.CreateDynamoSess(dynamoURL, dynamoRegion),
 		consumerIndex,
+		options...,
 	)
 
 	if err != nil {
@@ -1,9 +1,44 @@
 package apigateway
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrUnknownColumn = errors.New("unknown column")
+
+const (
+	FormatCSV       = "csv"
+	FormatJSON      = "json"
+	FormatJSONLines = "jsonl"
+	FormatParquet   = "parquet"
+)
+
+const (
+	GroupByService  = "service"
+	GroupByConsumer = "consumer"
+)
+
+// Stdout as the output path writes the export to the standard output.
+const Stdout = "-"
+
+// ColumnType is the type of the values of a column on the formats that have
+// types, like JSON, as the values are always given as strings.
+type ColumnType int
+
+const (
+	ColumnString ColumnType = iota
+	ColumnNumber
+	ColumnBoolean
+	// ColumnObject values are JSON already, like the nested fields of the log.
+	ColumnObject
 )
 
 type Log struct {
@@ -18,6 +53,7 @@ type Log struct {
 	StartedAt           int64               `json:"started_at"`
 	ServiceID           string              `json:"service_id"`
 	ConsumerID          string              `json:"consumer_id"`
+	ID                  string              `json:"id"`
 }
 
 type Request struct {
@@ -96,11 +132,86 @@ type Latencies struct {
 	Request int `json:"request"`
 }
 
+// ParseOptions says how the logs are parsed. NoCheckpoint writes no
+// checkpoint, so the parse cannot be resumed.
+type ParseOptions struct {
+	Resume         bool
+	Lenient        bool
+	DeadLetterPath string
+	MaxLineSize    int
+	Stream         bool
+	NoCheckpoint   bool
+}
+
+// ParseReport counts the logs accepted and rejected, and of the accepted ones
+// written, the New ones and the Duplicates already stored by an earlier parse.
+type ParseReport struct {
+	Accepted        int
+	Rejected        int
+	New             int
+	Duplicates      int
+	DeadLetterPaths []string
+}
+
+type TimeRange struct {
+	From int64
+	To   int64
+}
+
+// OutputOptions says how and where an export is written. Path is a file, a
+// directory, where the file is named by FileName, or Stdout. FileName may use
+// the {prefix}, {id}, {date} and {ext} placeholders.
+type OutputOptions struct {
+	Format    string
+	Delimiter rune
+	QuoteAll  bool
+	NoHeader  bool
+	Path      string
+	FileName  string
+}
+
+type ExportOptions struct {
+	Range   TimeRange
+	Flatten bool
+	Columns []string
+	Output  OutputOptions
+}
+
+type MetricsOptions struct {
+	Range      TimeRange
+	SortBy     string
+	Descending bool
+	Output     OutputOptions
+}
+
+type SeriesOptions struct {
+	Range  TimeRange
+	Bucket time.Duration
+	Output OutputOptions
+}
+
+type TopOptions struct {
+	Range  TimeRange
+	By     string
+	Metric string
+	Limit  int
+	Output OutputOptions
+}
+
 type LogService interface {
-	Parse(path string) error
-	ExportByService(service string) error
-	ExportByConsumer(consumer string) error
-	ExportMetricsByService(service string) error
+	Parse(path string, options ParseOptions) (ParseReport, error)
+	ExportByService(service string, options ExportOptions) (string, error)
+	ExportByConsumer(consumer string, options ExportOptions) (string, error)
+	ExportMetricsByService(service string, options ExportOptions) (string, error)
+	ExportMetricsByConsumer(consumer string, options ExportOptions) (string, error)
+	ExportMetricsAllServices(options MetricsOptions) (string, error)
+	ExportMetricsSeries(service string, options SeriesOptions) (string, error)
+	ExportStatusMetrics(group string, id string, options ExportOptions) (string, error)
+	Top(options TopOptions) (string, error)
+}
+
+func (t TimeRange) IsZero() bool {
+	return t.From == 0 && t.To == 0
 }
 
 func GetJsonFieldsFromLogStruct() []string {
@@ -114,6 +225,186 @@ func GetJsonFieldsFromLogStruct() []string {
 	return columns
 }
 
+// GetJsonTypesFromLogStruct has the types of the columns of
+// GetJsonFieldsFromLogStruct.
+func GetJsonTypesFromLogStruct() []ColumnType {
+	var types []ColumnType
+
+	t := reflect.TypeOf(Log{})
+	for i := 0; i < t.NumField(); i++ {
+		types = append(types, columnType(t.Field(i).Type))
+	}
+
+	return types
+}
+
+// GetFlatJsonFieldsFromLogStruct walks the nested structs of the log, naming
+// each field by the dotted path of its json tags, e.g. response.status.
+func GetFlatJsonFieldsFromLogStruct() []string {
+	return flatFields(reflect.TypeOf(Log{}), "")
+}
+
+func flatFields(t reflect.Type, prefix string) []string {
+	var columns []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := prefix + field.Tag.Get("json")
+
+		if field.Type.Kind() == reflect.Struct {
+			columns = append(columns, flatFields(field.Type, name+".")...)
+			continue
+		}
+
+		columns = append(columns, name)
+	}
+
+	return columns
+}
+
+// GetFlatJsonTypesFromLogStruct has the types of the columns of
+// GetFlatJsonFieldsFromLogStruct.
+func GetFlatJsonTypesFromLogStruct() []ColumnType {
+	return flatTypes(reflect.TypeOf(Log{}))
+}
+
+func flatTypes(t reflect.Type) []ColumnType {
+	var types []ColumnType
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.Type.Kind() == reflect.Struct {
+			types = append(types, flatTypes(field.Type)...)
+			continue
+		}
+
+		types = append(types, columnType(field.Type))
+	}
+
+	return types
+}
+
+// columnType is the type of the values of a field, as they are written: a
+// nested struct as JSON, a list joined by commas and any other value, like the
+// hosts of a route, as text.
+func columnType(t reflect.Type) ColumnType {
+	switch t.Kind() {
+	case reflect.Struct:
+		return ColumnObject
+	case reflect.Bool:
+		return ColumnBoolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return ColumnNumber
+	default:
+		return ColumnString
+	}
+}
+
+// ToFlatSlice has the values in the order of GetFlatJsonFieldsFromLogStruct,
+// with lists joined by commas.
+func (l *Log) ToFlatSlice() []string {
+	return flatValues(reflect.ValueOf(*l))
+}
+
+func flatValues(v reflect.Value) []string {
+	var values []string
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+
+		if field.Kind() == reflect.Struct {
+			values = append(values, flatValues(field)...)
+			continue
+		}
+
+		values = append(values, flatValue(field))
+	}
+
+	return values
+}
+
+func flatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return ""
+		}
+
+		return flatValue(v.Elem())
+	case reflect.Slice:
+		items := make([]string, v.Len())
+
+		for i := range items {
+			items[i] = flatValue(v.Index(i))
+		}
+
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// GetColumnFromLogStruct returns how to get the value of a column, given by
+// the dotted path of its json tags, and its type. Nested structs are written
+// as JSON, like on ToSlice, and the other fields like on ToFlatSlice.
+func GetColumnFromLogStruct(path string) (func(l *Log) string, ColumnType, error) {
+	var index []int
+
+	t := reflect.TypeOf(Log{})
+
+	for _, name := range strings.Split(path, ".") {
+		if t.Kind() != reflect.Struct {
+			return nil, ColumnString, fmt.Errorf("%w: %s", ErrUnknownColumn, path)
+		}
+
+		field, ok := fieldByJsonTag(t, name)
+
+		if !ok {
+			return nil, ColumnString, fmt.Errorf("%w: %s", ErrUnknownColumn, path)
+		}
+
+		index = append(index, field.Index...)
+		t = field.Type
+	}
+
+	return func(l *Log) string {
+		v := reflect.ValueOf(*l).FieldByIndex(index)
+
+		if v.Kind() == reflect.Struct {
+			data, _ := json.Marshal(v.Interface())
+			return string(data)
+		}
+
+		return flatValue(v)
+	}, columnType(t), nil
+}
+
+func fieldByJsonTag(t reflect.Type, tag string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("json") == tag {
+			return t.Field(i), true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// NewLogID identifies a log by the hash of its fields, so two logs only have
+// the same ID when they are the same record, e.g. a file parsed twice, or a
+// log copied from another table and its line parsed again.
+func NewLogID(l *Log) string {
+	fields := *l
+	fields.ID = ""
+
+	record, _ := json.Marshal(fields)
+	sum := sha256.Sum256(record)
+
+	return hex.EncodeToString(sum[:16])
+}
+
 func (l *Log) ToSlice() []string {
 	request, _ := json.Marshal(l.Request)
 	response, _ := json.Marshal(l.Response)
@@ -134,5 +425,6 @@ func (l *Log) ToSlice() []string {
 		strconv.Itoa(int(l.StartedAt)),
 		l.ServiceID,
 		l.ConsumerID,
+		l.ID,
 	}
 }
@@ -0,0 +1,141 @@
+package apigateway
+
+import (
+	"errors"
+	as "github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLog_ShouldFlattenNestedFields(t *testing.T) {
+	assert := as.New(t)
+
+	l := Log{
+		Request:  Request{Method: "GET", Headers: RequestHeaders{UserAgent: "curl"}},
+		Response: Response{Status: 200},
+		Route: Route{
+			Hosts: []interface{}{"a.com", "b.com"},
+			Paths: []string{"/orders", "/payments"},
+		},
+		Latencies: Latencies{Proxy: 42},
+		StartedAt: 12345,
+	}
+	l.Route.Service.ID = "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	columns := GetFlatJsonFieldsFromLogStruct()
+	values := l.ToFlatSlice()
+
+	assert.Len(values, len(columns))
+
+	row := map[string]string{}
+
+	for i, column := range columns {
+		row[column] = values[i]
+	}
+
+	assert.Equal("GET", row["request.method"])
+	assert.Equal("curl", row["request.headers.user-agent"])
+	assert.Equal("200", row["response.status"])
+	assert.Equal("a.com,b.com", row["route.hosts"])
+	assert.Equal("/orders,/payments", row["route.paths"])
+	assert.Equal("c3e86413-648a-3552-90c3-b13491ee07d6", row["route.service.id"])
+	assert.Equal("42", row["latencies.proxy"])
+	assert.Equal("12345", row["started_at"])
+	assert.Equal("", row["route.methods"])
+}
+
+func TestLog_ShouldFlattenNilHosts(t *testing.T) {
+	assert := as.New(t)
+
+	columns := GetFlatJsonFieldsFromLogStruct()
+	values := (&Log{}).ToFlatSlice()
+
+	for i, column := range columns {
+		if column == "route.hosts" {
+			assert.Equal("", values[i])
+		}
+	}
+}
+
+func TestLog_ShouldGetColumnByPath(t *testing.T) {
+	assert := as.New(t)
+
+	l := &Log{
+		Response:  Response{Status: 404},
+		Latencies: Latencies{Proxy: 1, Gateway: 2, Request: 3},
+		StartedAt: 12345,
+	}
+
+	for path, expected := range map[string]string{
+		"response.status": "404",
+		"started_at":      "12345",
+		"latencies":       `{"proxy":1,"gateway":2,"request":3}`,
+	} {
+		get, _, err := GetColumnFromLogStruct(path)
+
+		assert.Nil(err)
+		assert.Equal(expected, get(l), path)
+	}
+}
+
+func TestLog_ShouldTypeColumnsByField(t *testing.T) {
+	assert := as.New(t)
+
+	for path, expected := range map[string]ColumnType{
+		"response.status":      ColumnNumber,
+		"started_at":           ColumnNumber,
+		"route.preserve_host":  ColumnBoolean,
+		"latencies":            ColumnObject,
+		"service.host":         ColumnString,
+		"route.paths":          ColumnString,
+		"route.hosts":          ColumnString,
+		"request.headers.host": ColumnString,
+	} {
+		_, columnType, err := GetColumnFromLogStruct(path)
+
+		assert.Nil(err)
+		assert.Equal(expected, columnType, path)
+	}
+
+	assert.Len(GetJsonTypesFromLogStruct(), len(GetJsonFieldsFromLogStruct()))
+	assert.Equal(ColumnObject, GetJsonTypesFromLogStruct()[0])
+
+	columns := GetFlatJsonFieldsFromLogStruct()
+	types := GetFlatJsonTypesFromLogStruct()
+
+	assert.Len(types, len(columns))
+
+	for i, column := range columns {
+		_, columnType, _ := GetColumnFromLogStruct(column)
+
+		assert.Equal(columnType, types[i], column)
+	}
+}
+
+func TestLog_ShouldReturnErrorWithUnknownColumn(t *testing.T) {
+	assert := as.New(t)
+
+	for _, path := range []string{"status", "response.status.code", "response.", ""} {
+		_, _, err := GetColumnFromLogStruct(path)
+
+		assert.True(errors.Is(err, ErrUnknownColumn), path)
+	}
+}
+
+func TestNewLogID_ShouldIdentifyTheLogByItsFields(t *testing.T) {
+	assert := as.New(t)
+
+	l := Log{Request: Request{Method: "GET"}, StartedAt: 12345, ServiceID: "s"}
+	id := NewLogID(&l)
+
+	// A stored log, which already has its ID, gets the one it was parsed with.
+	stored := l
+	stored.ID = id
+
+	assert.Len(id, 32)
+	assert.Equal(id, NewLogID(&stored))
+
+	other := l
+	other.Request.Method = "POST"
+
+	assert.NotEqual(id, NewLogID(&other))
+}
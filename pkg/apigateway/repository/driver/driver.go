@@ -2,13 +2,58 @@ package driver
 
 import (
 	"api-gateway-log-parser/pkg/apigateway"
+	"errors"
 )
 
+var ErrInvalidToken = errors.New("invalid continuation token")
+
+// Query selects the logs of a service, of a consumer or, when neither is
+// given, of every service, started in the time range.
+type Query struct {
+	ServiceID  string
+	ConsumerID string
+	Range      apigateway.TimeRange
+	Limit      int
+}
+
+// Page has the logs found and the token to get the next page, which is empty
+// on the last one. The token is opaque, it is only meant to be given back to
+// Query.
+type Page struct {
+	Logs      []*apigateway.Log
+	NextToken string
+}
+
 type ApiGatewayLogDriver interface {
 	GetTableName() string
 	Client() interface{}
 	Add(log *apigateway.Log) error
-	AddBatch(...*apigateway.Log) error
-	GetByService(serviceID string, limit int) ([]*apigateway.Log, error)
-	GetByConsumer(consumerID string, limit int) ([]*apigateway.Log, error)
+	AddBatch(...*apigateway.Log) (int, error)
+	Query(query Query, token string) (Page, error)
+}
+
+// LatencyStats is the distribution of a latency type, with its values at the
+// quantiles asked for, on their order.
+type LatencyStats struct {
+	Avg       float64
+	Min       int64
+	Max       int64
+	Quantiles []int64
+}
+
+// LatencySummary is the distribution of each latency type over the logs of a
+// query.
+type LatencySummary struct {
+	Count   int64
+	Request LatencyStats
+	Proxy   LatencyStats
+	Gateway LatencyStats
+}
+
+// LatencyAggregator is a driver that computes the latencies of a query
+// itself, so its logs are not all read to compute them. The quantiles are
+// the lowest value with the q fraction of the logs at or below it, like
+// metrics.Histogram, negative latencies counted as 0.
+type LatencyAggregator interface {
+	SummarizeLatencies(query Query, quantiles []float64) (LatencySummary, error)
 }
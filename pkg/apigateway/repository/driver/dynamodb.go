@@ -2,12 +2,22 @@ package driver
 
 import (
 	"api-gateway-log-parser/pkg/apigateway"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"math"
+	"math/rand"
 	"strconv"
+	"sync"
+	"time"
 )
 
 func CreateDynamoSess(url string, region string) *dynamodb.DynamoDB {
@@ -22,64 +32,212 @@ func CreateDynamoSess(url string, region string) *dynamodb.DynamoDB {
 	})
 }
 
+const (
+	sortKey            = "sort_key"
+	batchSize          = 25
+	defaultMaxRetries  = 8
+	defaultBaseBackoff = 50 * time.Millisecond
+	defaultMaxBackoff  = 5 * time.Second
+)
+
+type UnprocessedLogsError struct {
+	Logs []*apigateway.Log
+}
+
+func (e *UnprocessedLogsError) Error() string {
+	return fmt.Sprintf("%d logs could not be written to dynamodb after retrying", len(e.Logs))
+}
+
 type dynamoDB struct {
-	db               *dynamodb.DynamoDB
-	tableName        string
-	consumerIndex    string
-	startKey         map[string]*dynamodb.AttributeValue
-	lastPageAchieved bool
+	db            dynamodbiface.DynamoDBAPI
+	tableName     string
+	consumerIndex string
+	maxRetries    int
+	baseBackoff   time.Duration
+	maxBackoff    time.Duration
+	sleep         func(time.Duration)
+	random        *rand.Rand
+	randomMutex   sync.Mutex
+}
+
+type DynamoDBOption func(*dynamoDB)
+
+func WithMaxRetries(maxRetries int) DynamoDBOption {
+	return func(d *dynamoDB) {
+		if maxRetries >= 0 {
+			d.maxRetries = maxRetries
+		}
+	}
+}
+
+func WithRetryBackoff(base time.Duration, max time.Duration) DynamoDBOption {
+	return func(d *dynamoDB) {
+		if base > 0 && max >= base {
+			d.baseBackoff = base
+			d.maxBackoff = max
+		}
+	}
 }
 
-func NewDynamoDBDriver(tableName string, db *dynamodb.DynamoDB, consumerIndex string) (ApiGatewayLogDriver, error) {
-	return &dynamoDB{
+func NewDynamoDBDriver(tableName string, db dynamodbiface.DynamoDBAPI, consumerIndex string, options ...DynamoDBOption) (ApiGatewayLogDriver, error) {
+	d := &dynamoDB{
 		tableName:     tableName,
 		db:            db,
 		consumerIndex: consumerIndex,
-	}, nil
+		maxRetries:    defaultMaxRetries,
+		baseBackoff:   defaultBaseBackoff,
+		maxBackoff:    defaultMaxBackoff,
+		sleep:         time.Sleep,
+		random:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	for _, option := range options {
+		option(d)
+	}
+
+	return d, nil
 }
 
 func (d *dynamoDB) Add(log *apigateway.Log) error {
 	panic("implement me")
 }
 
-func (d *dynamoDB) AddBatch(logs ...*apigateway.Log) error {
-	batchSize := 25
+// AddBatch writes each log with a put conditioned on its key not being on
+// the table yet, and returns how many were new. A log written by another
+// worker at the same time is then counted by only one of them. The puts of
+// each 25 logs run at once.
+func (d *dynamoDB) AddBatch(logs ...*apigateway.Log) (int, error) {
+	var unprocessed []*apigateway.Log
+	var items []map[string]*dynamodb.AttributeValue
+
+	added := 0
+	seen := map[string]bool{}
+
+	// A log repeated on the batch, e.g. a line repeated on a file, is put once.
+	for _, log := range logs {
+		item, err := dynamodbattribute.MarshalMap(&log)
+		if err != nil {
+			return added, err
+		}
 
-	logsCount := len(logs)
+		item[sortKey] = &dynamodb.AttributeValue{S: aws.String(newSortKey(log.StartedAt, log.ID))}
 
-	for i := 0; i < logsCount; i += batchSize {
+		if !seen[itemKey(item)] {
+			seen[itemKey(item)] = true
+			items = append(items, item)
+		}
+	}
+
+	itemsCount := len(items)
+
+	for i := 0; i < itemsCount; i += batchSize {
 		low := i
 		high := low + batchSize
 
-		if high > logsCount {
-			high = logsCount
+		if high > itemsCount {
+			high = itemsCount
+		}
+
+		stored := make([]bool, high-low)
+		errs := make([]error, high-low)
+
+		var wg sync.WaitGroup
+
+		for j, item := range items[low:high] {
+			wg.Add(1)
+
+			go func(j int, item map[string]*dynamodb.AttributeValue) {
+				defer wg.Done()
+
+				stored[j], errs[j] = d.putItem(item)
+			}(j, item)
 		}
 
-		l := logs[low:high]
-		var writeRequests []*dynamodb.WriteRequest
+		wg.Wait()
+
+		for j, err := range errs {
+			var unprocessedErr *UnprocessedLogsError
+			if errors.As(err, &unprocessedErr) {
+				unprocessed = append(unprocessed, unprocessedErr.Logs...)
+				continue
+			}
 
-		for _, log := range l {
-			item, err := dynamodbattribute.MarshalMap(&log)
 			if err != nil {
-				return err
+				return added, err
 			}
-			writeRequests = append(writeRequests, &dynamodb.WriteRequest{
-				PutRequest: &dynamodb.PutRequest{Item: item},
-			})
+
+			if stored[j] {
+				added++
+			}
+		}
+	}
+
+	if len(unprocessed) > 0 {
+		return added, &UnprocessedLogsError{Logs: unprocessed}
+	}
+
+	return added, nil
+}
+
+func itemKey(item map[string]*dynamodb.AttributeValue) string {
+	return aws.StringValue(item["service_id"].S) + "\x00" + aws.StringValue(item[sortKey].S)
+}
+
+// putItem tells whether the item was new. An item on the table already is
+// left as it is, as its key is a hash of the same record.
+func (d *dynamoDB) putItem(item map[string]*dynamodb.AttributeValue) (bool, error) {
+	input := &dynamodb.PutItemInput{
+		TableName:           aws.String(d.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(" + sortKey + ")"),
+	}
+
+	for attempt := 0; ; attempt++ {
+		_, err := d.db.PutItem(input)
+
+		if err == nil {
+			return true, nil
 		}
 
-		input := &dynamodb.BatchWriteItemInput{
-			RequestItems: map[string][]*dynamodb.WriteRequest{
-				d.tableName: writeRequests,
-			},
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return false, nil
 		}
 
-		_, err := d.db.BatchWriteItem(input)
-		if err != nil {
-			return err
+		if !request.IsErrorThrottle(err) {
+			return false, err
+		}
+
+		if attempt >= d.maxRetries {
+			return false, d.unprocessedLogsError(item)
 		}
+
+		d.sleep(d.backoff(attempt))
+	}
+}
+
+func (d *dynamoDB) backoff(attempt int) time.Duration {
+	backoff := d.maxBackoff
+
+	if attempt < 32 && d.baseBackoff<<uint(attempt) < d.maxBackoff {
+		backoff = d.baseBackoff << uint(attempt)
+	}
+
+	d.randomMutex.Lock()
+	defer d.randomMutex.Unlock()
+
+	return time.Duration(d.random.Int63n(int64(backoff) + 1))
+}
+
+func (d *dynamoDB) unprocessedLogsError(item map[string]*dynamodb.AttributeValue) error {
+	var log apigateway.Log
+
+	err := dynamodbattribute.UnmarshalMap(item, &log)
+	if err != nil {
+		return err
 	}
-	return nil
+
+	return &UnprocessedLogsError{Logs: []*apigateway.Log{&log}}
 }
 
 func (d *dynamoDB) Client() interface{} {
@@ -90,115 +248,158 @@ func (d *dynamoDB) GetTableName() string {
 	return d.tableName
 }
 
-func (d *dynamoDB) GetByService(serviceID string, limit int) ([]*apigateway.Log, error) {
-	if d.lastPageAchieved {
-		return nil, nil
+func (d *dynamoDB) Query(query Query, token string) (Page, error) {
+	startKey, err := decodeToken(token)
+
+	if err != nil {
+		return Page{}, err
 	}
 
-	input := &dynamodb.QueryInput{
-		TableName: &d.tableName,
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":value": {
-				S: &serviceID,
-			},
-		},
-		Limit:                  aws.Int64(int64(limit)),
-		KeyConditionExpression: aws.String(fmt.Sprintf("%s = :value", "service_id")),
+	if query.ServiceID == "" && query.ConsumerID == "" {
+		return d.scan(query, startKey)
 	}
 
-	return d.getLogsByQuery(input)
-}
+	input := &dynamodb.QueryInput{
+		TableName:         &d.tableName,
+		Limit:             aws.Int64(int64(query.Limit)),
+		ExclusiveStartKey: startKey,
+	}
 
-func (d *dynamoDB) GetByConsumer(consumerID string, limit int) ([]*apigateway.Log, error) {
-	if d.lastPageAchieved {
-		return nil, nil
+	if query.ConsumerID != "" {
+		input.IndexName = aws.String(d.consumerIndex)
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{":value": {S: &query.ConsumerID}}
+		input.KeyConditionExpression = aws.String(fmt.Sprintf("%s = :value", "consumer_id"))
+	} else {
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{":value": {S: &query.ServiceID}}
+		input.KeyConditionExpression = aws.String(fmt.Sprintf("%s = :value", "service_id"))
 	}
 
-	input := &dynamodb.QueryInput{
-		TableName: &d.tableName,
-		IndexName: aws.String(d.consumerIndex),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":value": {
-				S: &consumerID,
-			},
-		},
-		Limit:                  aws.Int64(int64(limit)),
-		KeyConditionExpression: aws.String(fmt.Sprintf("%s = :value", "consumer_id")),
+	withTimeRange(input, query.Range)
+
+	result, err := d.db.Query(input)
+
+	if err != nil {
+		return Page{}, err
 	}
 
-	return d.getLogsByQuery(input)
+	return newPage(result.Items, result.LastEvaluatedKey)
 }
 
-func (d *dynamoDB) getLogsByQuery(input *dynamodb.QueryInput) ([]*apigateway.Log, error) {
-	if d.startKey != nil {
-		input.ExclusiveStartKey = d.startKey
+func (d *dynamoDB) scan(query Query, startKey map[string]*dynamodb.AttributeValue) (Page, error) {
+	input := &dynamodb.ScanInput{
+		TableName:         &d.tableName,
+		Limit:             aws.Int64(int64(query.Limit)),
+		ExclusiveStartKey: startKey,
 	}
 
-	var logs []*apigateway.Log
+	if !query.Range.IsZero() {
+		input.ExpressionAttributeValues = timeRangeValues(query.Range)
+		input.FilterExpression = aws.String("started_at BETWEEN :from AND :to")
+	}
 
-	result, err := d.db.Query(input)
+	result, err := d.db.Scan(input)
 
 	if err != nil {
-		return nil, err
+		return Page{}, err
 	}
 
-	if result == nil {
-		return nil, nil
+	return newPage(result.Items, result.LastEvaluatedKey)
+}
+
+// newSortKey orders the logs of a service, or of a consumer, by when they
+// started, while the ID keeps apart the ones started on the same millisecond.
+// The time is padded, so the keys sort as the numbers would.
+func newSortKey(startedAt int64, id string) string {
+	return fmt.Sprintf("%019d#%s", startedAt, id)
+}
+
+// sortKeyRange has the first and last sort keys of the time range. "$" sorts
+// right after "#", so the range takes every log of its last millisecond,
+// whatever their ID.
+func sortKeyRange(period apigateway.TimeRange) (string, string) {
+	to := period.To
+	if to == 0 {
+		to = math.MaxInt64
 	}
 
-	return d.convertToLogs(result, logs)
+	return fmt.Sprintf("%019d", period.From), fmt.Sprintf("%019d$", to)
 }
 
-func (d *dynamoDB) convertToLogs(result *dynamodb.QueryOutput, logs []*apigateway.Log) ([]*apigateway.Log, error) {
-	err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &logs)
+func withTimeRange(input *dynamodb.QueryInput, period apigateway.TimeRange) {
+	if period.IsZero() {
+		return
+	}
+
+	from, to := sortKeyRange(period)
 
-	if err != nil {
-		return nil, err
+	input.ExpressionAttributeValues[":from"] = &dynamodb.AttributeValue{S: aws.String(from)}
+	input.ExpressionAttributeValues[":to"] = &dynamodb.AttributeValue{S: aws.String(to)}
+
+	input.KeyConditionExpression = aws.String(*input.KeyConditionExpression + " AND " + sortKey + " BETWEEN :from AND :to")
+}
+
+func timeRangeValues(period apigateway.TimeRange) map[string]*dynamodb.AttributeValue {
+	to := period.To
+	if to == 0 {
+		to = math.MaxInt64
 	}
 
-	if result.LastEvaluatedKey == nil {
-		d.lastPageAchieved = true
-		return logs, nil
+	return map[string]*dynamodb.AttributeValue{
+		":from": {N: aws.String(strconv.FormatInt(period.From, 10))},
+		":to":   {N: aws.String(strconv.FormatInt(to, 10))},
 	}
+}
+
+func newPage(items []map[string]*dynamodb.AttributeValue, lastEvaluatedKey map[string]*dynamodb.AttributeValue) (Page, error) {
+	var page Page
+
+	err := dynamodbattribute.UnmarshalListOfMaps(items, &page.Logs)
 
-	var lastLog *apigateway.Log
-	err = dynamodbattribute.UnmarshalMap(result.LastEvaluatedKey, &lastLog)
 	if err != nil {
-		return nil, err
+		return Page{}, err
 	}
 
-	startedAt := strconv.Itoa(int(lastLog.StartedAt))
+	page.NextToken, err = encodeToken(lastEvaluatedKey)
 
-	if lastLog.ConsumerID != "" {
-		d.startKey = generateConsumerStartKey(lastLog, startedAt)
-		return logs, nil
+	if err != nil {
+		return Page{}, err
 	}
 
-	d.startKey = generateServiceStartKey(lastLog, startedAt)
-	return logs, nil
+	return page, nil
 }
 
-func generateServiceStartKey(lastLog *apigateway.Log, startedAt string) map[string]*dynamodb.AttributeValue {
-	return map[string]*dynamodb.AttributeValue{
-		"service_id": {
-			S: aws.String(lastLog.ServiceID),
-		},
-		"started_at": {
-			N: aws.String(startedAt),
-		},
+// encodeToken keeps the whole key DynamoDB stopped at, whatever the index
+// queried, so the next page starts right after it.
+func encodeToken(key map[string]*dynamodb.AttributeValue) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+
+	data, err := json.Marshal(key)
+
+	if err != nil {
+		return "", err
 	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
 }
 
-func generateConsumerStartKey(lastLog *apigateway.Log, startedAt string) map[string]*dynamodb.AttributeValue {
-	return map[string]*dynamodb.AttributeValue{
-		"service_id": {
-			S: aws.String(lastLog.ServiceID),
-		},
-		"started_at": {
-			N: aws.String(startedAt),
-		},
-		"consumer_id": {
-			S: aws.String(lastLog.ConsumerID),
-		},
+func decodeToken(token string) (map[string]*dynamodb.AttributeValue, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+
+	if err != nil {
+		return nil, ErrInvalidToken
 	}
+
+	var key map[string]*dynamodb.AttributeValue
+
+	if err = json.Unmarshal(data, &key); err != nil || len(key) == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	return key, nil
 }
@@ -0,0 +1,355 @@
+package driver
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	as "github.com/stretchr/testify/assert"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type putFunc func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
+
+type queryFunc func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error)
+
+type dynamoDBClientStub struct {
+	dynamodbiface.DynamoDBAPI
+	putItem putFunc
+	query   queryFunc
+	calls   int
+	puts    int
+	mutex   sync.Mutex
+}
+
+// PutItem is called by the puts of a batch at once, so it runs them one at a
+// time. It stores every item unless the test says otherwise.
+func (d *dynamoDBClientStub) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.puts++
+
+	if d.putItem == nil {
+		return &dynamodb.PutItemOutput{}, nil
+	}
+
+	return d.putItem(input)
+}
+
+func (d *dynamoDBClientStub) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	d.calls++
+	return d.query(input)
+}
+
+func newTestDriver(client dynamodbiface.DynamoDBAPI, options ...DynamoDBOption) *dynamoDB {
+	d, _ := NewDynamoDBDriver("logs", client, "ConsumerIDIndex", options...)
+
+	dynamo := d.(*dynamoDB)
+	dynamo.sleep = func(time.Duration) {}
+
+	return dynamo
+}
+
+func newTestLogs(count int) []*apigateway.Log {
+	var logs []*apigateway.Log
+
+	for i := 0; i < count; i++ {
+		logs = append(logs, &apigateway.Log{
+			ServiceID: "c3e86413-648a-3552-90c3-b13491ee07d6",
+			StartedAt: int64(12345 + i),
+		})
+	}
+
+	return logs
+}
+
+func TestDynamoDB_ShouldRetryThrottledPuts(t *testing.T) {
+	assert := as.New(t)
+
+	throttled := map[string]bool{}
+
+	client := &dynamoDBClientStub{}
+	client.putItem = func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+		key := *input.Item["sort_key"].S
+
+		if !throttled[key] {
+			throttled[key] = true
+
+			return nil, awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "throttled", nil)
+		}
+
+		return &dynamodb.PutItemOutput{}, nil
+	}
+
+	added, err := newTestDriver(client).AddBatch(newTestLogs(3)...)
+
+	assert.Nil(err)
+	assert.Equal(3, added)
+	assert.Equal(6, client.puts)
+}
+
+func TestDynamoDB_ShouldReturnUnprocessedLogsAfterRetries(t *testing.T) {
+	assert := as.New(t)
+
+	logs := newTestLogs(30)
+
+	// The first log of each 25 is always throttled.
+	client := &dynamoDBClientStub{}
+	client.putItem = func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+		if *input.Item["started_at"].N == strconv.FormatInt(logs[0].StartedAt, 10) || *input.Item["started_at"].N == strconv.FormatInt(logs[25].StartedAt, 10) {
+			return nil, awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "throttled", nil)
+		}
+
+		return &dynamodb.PutItemOutput{}, nil
+	}
+
+	added, err := newTestDriver(client, WithMaxRetries(2)).AddBatch(logs...)
+
+	var unprocessedErr *UnprocessedLogsError
+
+	assert.True(errors.As(err, &unprocessedErr))
+	assert.Equal(28, added)
+	assert.Len(unprocessedErr.Logs, 2)
+	assert.Equal(logs[0].StartedAt, unprocessedErr.Logs[0].StartedAt)
+	assert.Equal(logs[25].StartedAt, unprocessedErr.Logs[1].StartedAt)
+	assert.Equal(28+2*3, client.puts)
+}
+
+func TestDynamoDB_ShouldReturnErrorOnPut(t *testing.T) {
+	assert := as.New(t)
+
+	driverErr := errors.New("error on writing logs")
+
+	client := &dynamoDBClientStub{}
+	client.putItem = func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+		return nil, driverErr
+	}
+
+	_, err := newTestDriver(client).AddBatch(newTestLogs(3)...)
+
+	assert.Same(driverErr, err)
+	assert.Equal(3, client.puts)
+}
+
+func TestDynamoDB_ShouldCapBackoff(t *testing.T) {
+	assert := as.New(t)
+
+	d := newTestDriver(&dynamoDBClientStub{}, WithRetryBackoff(time.Millisecond, 10*time.Millisecond))
+
+	for attempt := 0; attempt < 64; attempt++ {
+		assert.True(d.backoff(attempt) <= 10*time.Millisecond)
+	}
+}
+
+func TestDynamoDB_ShouldQueryByTimeRange(t *testing.T) {
+	assert := as.New(t)
+
+	input := &dynamodb.QueryInput{
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":value": {S: aws.String("c3e86413-648a-3552-90c3-b13491ee07d6")},
+		},
+		KeyConditionExpression: aws.String("service_id = :value"),
+	}
+
+	withTimeRange(input, apigateway.TimeRange{From: 1000})
+
+	assert.Equal("service_id = :value AND sort_key BETWEEN :from AND :to", *input.KeyConditionExpression)
+	assert.Equal("0000000000000001000", *input.ExpressionAttributeValues[":from"].S)
+	assert.Equal("9223372036854775807$", *input.ExpressionAttributeValues[":to"].S)
+
+	first := newSortKey(1000, "ffffffffffffffffffffffffffffffff")
+
+	assert.True(*input.ExpressionAttributeValues[":from"].S < first)
+	assert.True(first < newSortKey(1001, "00000000000000000000000000000000"))
+	assert.True(newSortKey(999, "ffffffffffffffffffffffffffffffff") < *input.ExpressionAttributeValues[":from"].S)
+}
+
+func TestDynamoDB_ShouldKeepLogsOfTheSameMillisecondApart(t *testing.T) {
+	assert := as.New(t)
+
+	var keys []string
+
+	client := &dynamoDBClientStub{putItem: func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+		keys = append(keys, *input.Item["sort_key"].S)
+
+		return &dynamodb.PutItemOutput{}, nil
+	}}
+
+	logs := newTestLogs(2)
+	logs[1].StartedAt = logs[0].StartedAt
+	logs[0].ID = "a"
+	logs[1].ID = "b"
+
+	added, err := newTestDriver(client).AddBatch(logs...)
+
+	sort.Strings(keys)
+
+	assert.Nil(err)
+	assert.Equal(2, added)
+	assert.Equal([]string{"0000000000000012345#a", "0000000000000012345#b"}, keys)
+}
+
+func TestDynamoDB_ShouldQueryWithoutTimeRange(t *testing.T) {
+	assert := as.New(t)
+
+	input := &dynamodb.QueryInput{
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{},
+		KeyConditionExpression:    aws.String("service_id = :value"),
+	}
+
+	withTimeRange(input, apigateway.TimeRange{})
+
+	assert.Equal("service_id = :value", *input.KeyConditionExpression)
+	assert.Len(input.ExpressionAttributeValues, 0)
+}
+
+func TestDynamoDB_ShouldPageWithContinuationTokens(t *testing.T) {
+	assert := as.New(t)
+
+	lastKey := map[string]*dynamodb.AttributeValue{
+		"service_id":  {S: aws.String("c3e86413-648a-3552-90c3-b13491ee07d6")},
+		"started_at":  {N: aws.String("12345")},
+		"consumer_id": {S: aws.String("29a5a16b-e4fa-331f-9f1c-5adea563d7de")},
+	}
+
+	client := &dynamoDBClientStub{query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+		item := map[string]*dynamodb.AttributeValue{"started_at": {N: aws.String("1")}}
+
+		if input.ExclusiveStartKey == nil {
+			return &dynamodb.QueryOutput{Items: []map[string]*dynamodb.AttributeValue{item}, LastEvaluatedKey: lastKey}, nil
+		}
+
+		assert.Equal(lastKey, input.ExclusiveStartKey)
+
+		item["started_at"] = &dynamodb.AttributeValue{N: aws.String("2")}
+
+		return &dynamodb.QueryOutput{Items: []map[string]*dynamodb.AttributeValue{item}}, nil
+	}}
+
+	d := newTestDriver(client)
+
+	query := Query{ConsumerID: "29a5a16b-e4fa-331f-9f1c-5adea563d7de", Limit: 1}
+
+	// Each query is read twice, one page at a time, to show that they do not
+	// share their position on the driver.
+	for i := 0; i < 2; i++ {
+		page, err := d.Query(query, "")
+		assert.Nil(err)
+		assert.Equal(int64(1), page.Logs[0].StartedAt)
+		assert.NotEmpty(page.NextToken)
+
+		page, err = d.Query(query, page.NextToken)
+		assert.Nil(err)
+		assert.Equal(int64(2), page.Logs[0].StartedAt)
+		assert.Empty(page.NextToken)
+	}
+
+	assert.Equal(4, client.calls)
+}
+
+func TestDynamoDB_ShouldReturnErrorOnInvalidToken(t *testing.T) {
+	assert := as.New(t)
+
+	client := &dynamoDBClientStub{}
+
+	d := newTestDriver(client)
+
+	for _, token := range []string{"not base64!", "bnVsbA"} {
+		_, err := d.Query(Query{ServiceID: "c3e86413-648a-3552-90c3-b13491ee07d6"}, token)
+
+		assert.Same(ErrInvalidToken, err, token)
+	}
+
+	assert.Equal(0, client.calls)
+}
+
+func TestDynamoDB_ShouldOnlyWriteLogsNotStoredYet(t *testing.T) {
+	assert := as.New(t)
+
+	logs := newTestLogs(3)
+
+	for i, log := range logs {
+		log.ID = strconv.Itoa(i)
+	}
+
+	var written []string
+
+	// The first log is stored already.
+	client := &dynamoDBClientStub{}
+	client.putItem = func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+		assert.Equal("attribute_not_exists(sort_key)", *input.ConditionExpression)
+
+		if *input.Item["sort_key"].S == "0000000000000012345#0" {
+			return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "the conditional request failed", nil)
+		}
+
+		written = append(written, *input.Item["sort_key"].S)
+
+		return &dynamodb.PutItemOutput{}, nil
+	}
+
+	// The repeated log is put once.
+	added, err := newTestDriver(client).AddBatch(append(logs, logs[1])...)
+
+	sort.Strings(written)
+
+	assert.Nil(err)
+	assert.Equal(2, added)
+	assert.Equal([]string{"0000000000000012346#1", "0000000000000012347#2"}, written)
+	assert.Equal(3, client.puts)
+}
+
+func TestDynamoDB_ShouldCountLogsWrittenAtOnceOnlyOnce(t *testing.T) {
+	assert := as.New(t)
+
+	stored := map[string]bool{}
+
+	client := &dynamoDBClientStub{}
+	client.putItem = func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+		key := *input.Item["service_id"].S + *input.Item["sort_key"].S
+
+		if stored[key] {
+			return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "the conditional request failed", nil)
+		}
+
+		stored[key] = true
+
+		return &dynamodb.PutItemOutput{}, nil
+	}
+
+	d := newTestDriver(client)
+	logs := newTestLogs(100)
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+
+	added := 0
+
+	// Two workers write the same logs at once.
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			count, err := d.AddBatch(logs...)
+			assert.Nil(err)
+
+			mutex.Lock()
+			added += count
+			mutex.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(100, added)
+	assert.Equal(200, client.puts)
+}
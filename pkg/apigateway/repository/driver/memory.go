@@ -0,0 +1,297 @@
+package driver
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type memoryItem struct {
+	serviceID  string
+	consumerID string
+	sortKey    string
+	log        apigateway.Log
+}
+
+// tableOrder orders the items like the DynamoDB table, by service_id and
+// sort_key.
+func tableOrder(a *memoryItem, b *memoryItem) int {
+	if c := strings.Compare(a.serviceID, b.serviceID); c != 0 {
+		return c
+	}
+
+	return strings.Compare(a.sortKey, b.sortKey)
+}
+
+// indexOrder orders the items like the consumer index, by consumer_id and
+// sort_key, and then by service_id, as logs of different services may have
+// the same sort key.
+func indexOrder(a *memoryItem, b *memoryItem) int {
+	if c := strings.Compare(a.consumerID, b.consumerID); c != 0 {
+		return c
+	}
+
+	if c := strings.Compare(a.sortKey, b.sortKey); c != 0 {
+		return c
+	}
+
+	return strings.Compare(a.serviceID, b.serviceID)
+}
+
+// memoryPartition has the items of a service, or of a consumer. They are
+// appended as they are added and only sorted when read, so adding logs does
+// not move the ones already there.
+type memoryPartition struct {
+	items  []*memoryItem
+	sorted bool
+}
+
+func (p *memoryPartition) add(item *memoryItem) {
+	p.items = append(p.items, item)
+	p.sorted = false
+}
+
+func (p *memoryPartition) sortedItems(order func(a *memoryItem, b *memoryItem) int) []*memoryItem {
+	if !p.sorted {
+		sort.Slice(p.items, func(i, j int) bool { return order(p.items[i], p.items[j]) < 0 })
+		p.sorted = true
+	}
+
+	return p.items
+}
+
+type memory struct {
+	tableName  string
+	keys       map[string]bool
+	services   map[string]*memoryPartition
+	consumers  map[string]*memoryPartition
+	serviceIDs []string
+	mutex      sync.Mutex
+}
+
+// NewMemoryDriver keeps the logs on memory, for tests and for runs that
+// export the logs they have just parsed. The logs are keyed, ordered and
+// paged like on DynamoDB, except that a Query without a limit returns every
+// log at once.
+func NewMemoryDriver(tableName string) (ApiGatewayLogDriver, error) {
+	return &memory{
+		tableName: tableName,
+		keys:      map[string]bool{},
+		services:  map[string]*memoryPartition{},
+		consumers: map[string]*memoryPartition{},
+	}, nil
+}
+
+func (d *memory) Add(log *apigateway.Log) error {
+	_, err := d.AddBatch(log)
+
+	return err
+}
+
+// AddBatch keeps only the logs not stored yet and returns how many they were.
+func (d *memory) AddBatch(logs ...*apigateway.Log) (int, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	added := 0
+
+	for _, log := range logs {
+		item := &memoryItem{
+			serviceID:  log.ServiceID,
+			consumerID: log.ConsumerID,
+			sortKey:    newSortKey(log.StartedAt, log.ID),
+			log:        *log,
+		}
+
+		key := item.serviceID + "\x00" + item.sortKey
+
+		if d.keys[key] {
+			continue
+		}
+
+		d.keys[key] = true
+
+		if d.services[item.serviceID] == nil {
+			d.services[item.serviceID] = &memoryPartition{}
+			d.serviceIDs = nil
+		}
+
+		if d.consumers[item.consumerID] == nil {
+			d.consumers[item.consumerID] = &memoryPartition{}
+		}
+
+		d.services[item.serviceID].add(item)
+		d.consumers[item.consumerID].add(item)
+
+		added++
+	}
+
+	return added, nil
+}
+
+// position is where the item is, or would be, on the sorted items. After it,
+// it is the first one that comes after the item.
+func position(items []*memoryItem, item *memoryItem, order func(a *memoryItem, b *memoryItem) int, after bool) int {
+	return sort.Search(len(items), func(i int) bool {
+		c := order(items[i], item)
+
+		return c > 0 || (c == 0 && !after)
+	})
+}
+
+func (d *memory) Client() interface{} {
+	return nil
+}
+
+func (d *memory) GetTableName() string {
+	return d.tableName
+}
+
+// Query finds the logs like DynamoDB would: a service or a consumer has its
+// logs by sort key, and without either, the table is scanned by service. The
+// token is the key of the last log read.
+func (d *memory) Query(query Query, token string) (Page, error) {
+	var last *memoryItem
+
+	if token != "" {
+		key, err := decodeRowKey(token)
+
+		if err != nil {
+			return Page{}, err
+		}
+
+		last = &memoryItem{serviceID: key.ServiceID, sortKey: newSortKey(key.StartedAt, key.ID)}
+	}
+
+	// Reading sorts the partitions, so it takes the lock like a write.
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if query.ServiceID == "" && query.ConsumerID == "" {
+		return d.scan(query, last), nil
+	}
+
+	partition, order := d.services[query.ServiceID], tableOrder
+	probe := &memoryItem{serviceID: query.ServiceID}
+
+	if query.ConsumerID != "" {
+		partition, order = d.consumers[query.ConsumerID], indexOrder
+		probe = &memoryItem{consumerID: query.ConsumerID}
+	}
+
+	if partition == nil {
+		return Page{}, nil
+	}
+
+	items := partition.sortedItems(order)
+
+	from, to := "", ""
+
+	if !query.Range.IsZero() {
+		from, to = sortKeyRange(query.Range)
+	}
+
+	probe.sortKey = from
+	start := position(items, probe, order, false)
+
+	if last != nil {
+		probe.serviceID, probe.sortKey = last.serviceID, last.sortKey
+		start = position(items, probe, order, true)
+	}
+
+	var page Page
+
+	for i := start; i < len(items) && !isFull(page, query.Limit); i++ {
+		if to != "" && items[i].sortKey > to {
+			break
+		}
+
+		page.Logs = append(page.Logs, items[i].copyLog())
+	}
+
+	if isFull(page, query.Limit) {
+		page.NextToken = encodeRowKey(page.Logs[len(page.Logs)-1])
+	}
+
+	return page, nil
+}
+
+// scan reads up to the limit of logs, service after service, and then filters
+// them by the time range, so like on DynamoDB, a page may have fewer logs, or
+// none, and still be followed by another.
+func (d *memory) scan(query Query, last *memoryItem) Page {
+	ids := d.sortedServiceIDs()
+
+	i, start := 0, 0
+
+	if last != nil {
+		i = sort.SearchStrings(ids, last.serviceID)
+
+		if i < len(ids) && ids[i] == last.serviceID {
+			start = position(d.services[ids[i]].sortedItems(tableOrder), last, tableOrder, true)
+		}
+	}
+
+	to := query.Range.To
+	if to == 0 {
+		to = math.MaxInt64
+	}
+
+	var page Page
+	var read *memoryItem
+
+	evaluated := 0
+
+	for ; i < len(ids) && !isLimit(evaluated, query.Limit); i++ {
+		items := d.services[ids[i]].sortedItems(tableOrder)
+
+		for _, item := range items[start:] {
+			if isLimit(evaluated, query.Limit) {
+				break
+			}
+
+			evaluated++
+			read = item
+
+			if query.Range.IsZero() || (item.log.StartedAt >= query.Range.From && item.log.StartedAt <= to) {
+				page.Logs = append(page.Logs, item.copyLog())
+			}
+		}
+
+		start = 0
+	}
+
+	if isLimit(evaluated, query.Limit) {
+		page.NextToken = encodeRowKey(&read.log)
+	}
+
+	return page
+}
+
+func (d *memory) sortedServiceIDs() []string {
+	if d.serviceIDs == nil {
+		for id := range d.services {
+			d.serviceIDs = append(d.serviceIDs, id)
+		}
+
+		sort.Strings(d.serviceIDs)
+	}
+
+	return d.serviceIDs
+}
+
+func isFull(page Page, limit int) bool {
+	return isLimit(len(page.Logs), limit)
+}
+
+func isLimit(count int, limit int) bool {
+	return limit > 0 && count == limit
+}
+
+func (i *memoryItem) copyLog() *apigateway.Log {
+	log := i.log
+
+	return &log
+}
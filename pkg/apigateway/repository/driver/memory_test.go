@@ -0,0 +1,239 @@
+package driver
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	as "github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func newTestMemoryDriver(t *testing.T, logs ...*apigateway.Log) ApiGatewayLogDriver {
+	d, _ := NewMemoryDriver("apigateway-logs")
+
+	if _, err := d.AddBatch(logs...); err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+func queryIDs(t *testing.T, d ApiGatewayLogDriver, query Query) ([]string, int) {
+	var ids []string
+
+	token := ""
+	pages := 0
+
+	for {
+		page, err := d.Query(query, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pages++
+
+		for _, log := range page.Logs {
+			ids = append(ids, log.ID)
+		}
+
+		if page.NextToken == "" {
+			return ids, pages
+		}
+
+		token = page.NextToken
+	}
+}
+
+func TestMemory_ShouldOnlyAddLogsNotStoredYet(t *testing.T) {
+	assert := as.New(t)
+
+	d := newTestMemoryDriver(t)
+
+	logs := []*apigateway.Log{
+		{ServiceID: "s", StartedAt: 1, ID: "a"},
+		{ServiceID: "s", StartedAt: 1, ID: "b"},
+		{ServiceID: "s", StartedAt: 1, ID: "a"},
+	}
+
+	added, err := d.AddBatch(logs...)
+	assert.Nil(err)
+	assert.Equal(2, added)
+
+	added, err = d.AddBatch(logs...)
+	assert.Nil(err)
+	assert.Equal(0, added)
+
+	// The stored logs are copies, so changing them changes nothing stored.
+	logs[0].ClientIP = "0.0.0.0"
+
+	page, err := d.Query(Query{ServiceID: "s"}, "")
+	assert.Nil(err)
+	assert.Len(page.Logs, 2)
+	assert.Empty(page.Logs[0].ClientIP)
+}
+
+func TestMemory_ShouldQueryBySortKey(t *testing.T) {
+	assert := as.New(t)
+
+	d := newTestMemoryDriver(t,
+		&apigateway.Log{ServiceID: "s2", ConsumerID: "c1", StartedAt: 3, ID: "a"},
+		&apigateway.Log{ServiceID: "s1", ConsumerID: "c1", StartedAt: 3, ID: "a"},
+		&apigateway.Log{ServiceID: "s1", ConsumerID: "c2", StartedAt: 10, ID: "b"},
+		&apigateway.Log{ServiceID: "s1", ConsumerID: "c1", StartedAt: 2, ID: "c"},
+	)
+
+	var ids []string
+
+	// 10 is after 3 as a number, even if not as a string.
+	ids, _ = queryIDs(t, d, Query{ServiceID: "s1"})
+	assert.Equal([]string{"c", "a", "b"}, ids)
+
+	ids, _ = queryIDs(t, d, Query{ConsumerID: "c1", Limit: 1})
+	assert.Equal([]string{"c", "a", "a"}, ids)
+
+	ids, _ = queryIDs(t, d, Query{ServiceID: "s1", Range: apigateway.TimeRange{From: 3, To: 10}})
+	assert.Equal([]string{"a", "b"}, ids)
+
+	ids, _ = queryIDs(t, d, Query{ConsumerID: "c1", Range: apigateway.TimeRange{From: 3}})
+	assert.Equal([]string{"a", "a"}, ids)
+
+	ids, _ = queryIDs(t, d, Query{ServiceID: "s3"})
+	assert.Empty(ids)
+}
+
+func TestMemory_ShouldPageLikeDynamoDB(t *testing.T) {
+	assert := as.New(t)
+
+	d := newTestMemoryDriver(t,
+		&apigateway.Log{ServiceID: "s1", StartedAt: 1, ID: "a"},
+		&apigateway.Log{ServiceID: "s1", StartedAt: 2, ID: "b"},
+		&apigateway.Log{ServiceID: "s2", StartedAt: 1, ID: "c"},
+		&apigateway.Log{ServiceID: "s2", StartedAt: 3, ID: "d"},
+	)
+
+	// A full page is followed by another, even when it is empty.
+	ids, pages := queryIDs(t, d, Query{ServiceID: "s1", Limit: 2})
+	assert.Equal([]string{"a", "b"}, ids)
+	assert.Equal(2, pages)
+
+	// The scan filters the logs it read, so its pages may have fewer logs.
+	query := Query{Range: apigateway.TimeRange{From: 3}, Limit: 2}
+
+	page, err := d.Query(query, "")
+	assert.Nil(err)
+	assert.Empty(page.Logs)
+	assert.NotEmpty(page.NextToken)
+
+	page, err = d.Query(query, page.NextToken)
+	assert.Nil(err)
+	assert.Len(page.Logs, 1)
+	assert.Equal("d", page.Logs[0].ID)
+
+	ids, _ = queryIDs(t, d, Query{})
+	assert.Equal([]string{"a", "b", "c", "d"}, ids)
+}
+
+func TestMemory_ShouldContinueAfterLogsAddedBetweenPages(t *testing.T) {
+	assert := as.New(t)
+
+	d := newTestMemoryDriver(t,
+		&apigateway.Log{ServiceID: "s", StartedAt: 1, ID: "a"},
+		&apigateway.Log{ServiceID: "s", StartedAt: 3, ID: "c"},
+	)
+
+	page, err := d.Query(Query{ServiceID: "s", Limit: 1}, "")
+	assert.Nil(err)
+
+	_, err = d.AddBatch(&apigateway.Log{ServiceID: "s", StartedAt: 0, ID: "z"}, &apigateway.Log{ServiceID: "s", StartedAt: 2, ID: "b"})
+	assert.Nil(err)
+
+	page, err = d.Query(Query{ServiceID: "s"}, page.NextToken)
+	assert.Nil(err)
+	assert.Len(page.Logs, 2)
+	assert.Equal("b", page.Logs[0].ID)
+	assert.Equal("c", page.Logs[1].ID)
+}
+
+func TestMemory_ShouldReturnErrorOnInvalidToken(t *testing.T) {
+	assert := as.New(t)
+
+	d := newTestMemoryDriver(t)
+
+	for _, token := range []string{"not base64!", "bnVsbA"} {
+		_, err := d.Query(Query{ServiceID: "s"}, token)
+
+		assert.Same(ErrInvalidToken, err, token)
+	}
+}
+
+func TestMemory_ShouldAddLogsConcurrently(t *testing.T) {
+	assert := as.New(t)
+
+	d := newTestMemoryDriver(t)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(worker int) {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				_, err := d.AddBatch(&apigateway.Log{ServiceID: "s", ConsumerID: "c", StartedAt: int64(j), ID: strconv.Itoa(worker)})
+				assert.Nil(err)
+
+				_, err = d.Query(Query{ConsumerID: "c", Limit: 10}, "")
+				assert.Nil(err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	ids, _ := queryIDs(t, d, Query{ServiceID: "s", Limit: 100})
+	assert.Len(ids, 800)
+}
+
+// BenchmarkMemory_AddAndQuery adds the logs in batches, like the parser, out
+// of order, and then reads a service page by page, like an export.
+func BenchmarkMemory_AddAndQuery(b *testing.B) {
+	for _, count := range []int{10000, 100000, 400000} {
+		b.Run(strconv.Itoa(count), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				d, _ := NewMemoryDriver("apigateway-logs")
+
+				batch := make([]*apigateway.Log, 0, 200)
+
+				for i := 0; i < count; i++ {
+					batch = append(batch, &apigateway.Log{
+						ServiceID:  "s" + strconv.Itoa(i%10),
+						ConsumerID: "c" + strconv.Itoa(i%100),
+						StartedAt:  int64(count - i),
+						ID:         strconv.Itoa(i),
+					})
+
+					if len(batch) == cap(batch) {
+						d.AddBatch(batch...)
+						batch = batch[:0]
+					}
+				}
+
+				d.AddBatch(batch...)
+
+				for token := ""; ; {
+					page, err := d.Query(Query{ServiceID: "s0", Limit: 1000}, token)
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					if page.NextToken == "" {
+						break
+					}
+
+					token = page.NextToken
+				}
+			}
+		})
+	}
+}
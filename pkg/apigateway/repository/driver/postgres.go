@@ -0,0 +1,446 @@
+package driver
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const day = 24 * time.Hour
+
+// postgresColumns are the columns of the table, on the order of the log
+// fields. The nested ones are JSONB.
+var postgresColumns = []string{
+	"request",
+	"upstream_uri",
+	"response",
+	"authenticated_entity",
+	"route",
+	"service",
+	"latencies",
+	"client_ip",
+	"started_at",
+	"service_id",
+	"consumer_id",
+	"id",
+}
+
+type postgres struct {
+	db         *sql.DB
+	tableName  string
+	partitions map[string]bool
+	mutex      sync.Mutex
+}
+
+// NewPostgresDriver stores the logs on PostgreSQL, on a table partitioned by
+// the day they started, creating it when it does not exist yet. Like on
+// DynamoDB, a log is keyed by its service, when it started and its ID.
+func NewPostgresDriver(dataSourceName string, tableName string) (ApiGatewayLogDriver, error) {
+	db, err := sql.Open("postgres", dataSourceName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d := &postgres{db: db, tableName: tableName, partitions: map[string]bool{}}
+
+	if err = d.createTable(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *postgres) createTable() error {
+	table := quoteIdentifier(d.tableName)
+
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS ` + table + ` (
+			request              JSONB NOT NULL,
+			upstream_uri         TEXT NOT NULL,
+			response             JSONB NOT NULL,
+			authenticated_entity JSONB NOT NULL,
+			route                JSONB NOT NULL,
+			service              JSONB NOT NULL,
+			latencies            JSONB NOT NULL,
+			client_ip            TEXT NOT NULL,
+			started_at           BIGINT NOT NULL,
+			service_id           TEXT NOT NULL,
+			consumer_id          TEXT NOT NULL,
+			id                   TEXT NOT NULL,
+			PRIMARY KEY (service_id, started_at, id)
+		) PARTITION BY RANGE (started_at)`,
+		`CREATE INDEX IF NOT EXISTS ` + quoteIdentifier(d.tableName+"_consumer_id") + ` ON ` + table + ` (consumer_id, started_at)`,
+		`CREATE INDEX IF NOT EXISTS ` + quoteIdentifier(d.tableName+"_started_at") + ` ON ` + table + ` (started_at)`,
+	}
+
+	for _, statement := range statements {
+		if _, err := d.db.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// partition is the day a log started on, as the name of its table and the
+// range of started_at it takes, in milliseconds, from inclusive to exclusive.
+type partition struct {
+	name string
+	from int64
+	to   int64
+}
+
+func newPartition(tableName string, startedAt int64) partition {
+	start := time.Unix(0, startedAt*int64(time.Millisecond)).UTC().Truncate(day)
+
+	return partition{
+		name: tableName + "_" + start.Format("20060102"),
+		from: start.UnixNano() / int64(time.Millisecond),
+		to:   start.Add(day).UnixNano() / int64(time.Millisecond),
+	}
+}
+
+// createPartitions creates the tables of the days the logs started on. The
+// workers of the parser add logs of the same days at once, so the partitions
+// are created one at a time.
+func (d *postgres) createPartitions(logs []*apigateway.Log) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, log := range logs {
+		p := newPartition(d.tableName, log.StartedAt)
+
+		if d.partitions[p.name] {
+			continue
+		}
+
+		_, err := d.db.Exec(`CREATE TABLE IF NOT EXISTS ` + quoteIdentifier(p.name) + ` PARTITION OF ` + quoteIdentifier(d.tableName) +
+			` FOR VALUES FROM (` + strconv.FormatInt(p.from, 10) + `) TO (` + strconv.FormatInt(p.to, 10) + `)`)
+
+		if err != nil {
+			return err
+		}
+
+		d.partitions[p.name] = true
+	}
+
+	return nil
+}
+
+func (d *postgres) Add(log *apigateway.Log) error {
+	_, err := d.AddBatch(log)
+
+	return err
+}
+
+// AddBatch copies the logs to a temporary table, from where the ones not
+// stored yet are inserted, as COPY cannot leave out the logs stored already.
+// It returns how many were new.
+func (d *postgres) AddBatch(logs ...*apigateway.Log) (int, error) {
+	if len(logs) == 0 {
+		return 0, nil
+	}
+
+	if err := d.createPartitions(logs); err != nil {
+		return 0, err
+	}
+
+	tx, err := d.db.Begin()
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	staging := d.tableName + "_staging"
+
+	_, err = tx.Exec(`CREATE TEMPORARY TABLE ` + quoteIdentifier(staging) + ` (LIKE ` + quoteIdentifier(d.tableName) + `) ON COMMIT DROP`)
+
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn(staging, postgresColumns...))
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, log := range logs {
+		values, err := postgresValues(log)
+
+		if err != nil {
+			stmt.Close()
+			return 0, err
+		}
+
+		if _, err = stmt.Exec(values...); err != nil {
+			stmt.Close()
+			return 0, err
+		}
+	}
+
+	// COPY is only sent once it is executed without values.
+	if _, err = stmt.Exec(); err != nil {
+		stmt.Close()
+		return 0, err
+	}
+
+	if err = stmt.Close(); err != nil {
+		return 0, err
+	}
+
+	// A batch may have the same log twice, e.g. a line repeated on a file.
+	result, err := tx.Exec(`INSERT INTO ` + quoteIdentifier(d.tableName) + ` SELECT DISTINCT ON (service_id, started_at, id) * FROM ` +
+		quoteIdentifier(staging) + ` ON CONFLICT DO NOTHING`)
+
+	if err != nil {
+		return 0, err
+	}
+
+	added, err := result.RowsAffected()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int(added), nil
+}
+
+func postgresValues(log *apigateway.Log) ([]interface{}, error) {
+	var values []interface{}
+
+	for _, field := range []interface{}{log.Request, log.Response, log.AuthenticatedEntity, log.Route, log.Service, log.Latencies} {
+		data, err := json.Marshal(field)
+
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, string(data))
+	}
+
+	return []interface{}{
+		values[0],
+		log.UpstreamURI,
+		values[1],
+		values[2],
+		values[3],
+		values[4],
+		values[5],
+		log.ClientIP,
+		log.StartedAt,
+		log.ServiceID,
+		log.ConsumerID,
+		log.ID,
+	}, nil
+}
+
+func (d *postgres) Client() interface{} {
+	return d.db
+}
+
+func (d *postgres) GetTableName() string {
+	return d.tableName
+}
+
+// Query pages through the logs by the key of the last one returned, like the
+// SQLite driver. The time range leaves out the partitions of other days.
+func (d *postgres) Query(query Query, token string) (Page, error) {
+	var args []interface{}
+
+	arg := func(value interface{}) string {
+		args = append(args, value)
+
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conditions := postgresConditions(query, arg)
+
+	if token != "" {
+		key, err := decodeRowKey(token)
+
+		if err != nil {
+			return Page{}, err
+		}
+
+		conditions = append(conditions, "(started_at, service_id, id) > ("+arg(key.StartedAt)+", "+arg(key.ServiceID)+", "+arg(key.ID)+")")
+	}
+
+	statement := `SELECT ` + strings.Join(postgresColumns, ", ") + ` FROM ` + quoteIdentifier(d.tableName)
+
+	if len(conditions) > 0 {
+		statement += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	statement += " ORDER BY started_at, service_id, id"
+
+	if query.Limit > 0 {
+		statement += " LIMIT " + arg(query.Limit)
+	}
+
+	rows, err := d.db.Query(statement, args...)
+
+	if err != nil {
+		return Page{}, err
+	}
+
+	defer rows.Close()
+
+	var page Page
+
+	for rows.Next() {
+		log, err := scanPostgresLog(rows)
+
+		if err != nil {
+			return Page{}, err
+		}
+
+		page.Logs = append(page.Logs, log)
+	}
+
+	if err = rows.Err(); err != nil {
+		return Page{}, err
+	}
+
+	// A full page may be followed by more logs, the next one tells.
+	if query.Limit > 0 && len(page.Logs) == query.Limit {
+		page.NextToken = encodeRowKey(page.Logs[len(page.Logs)-1])
+	}
+
+	return page, nil
+}
+
+// postgresConditions selects the logs of the query, with arg adding each
+// value as an argument of the statement.
+func postgresConditions(query Query, arg func(value interface{}) string) []string {
+	var conditions []string
+
+	if query.ServiceID != "" {
+		conditions = append(conditions, "service_id = "+arg(query.ServiceID))
+	} else if query.ConsumerID != "" {
+		conditions = append(conditions, "consumer_id = "+arg(query.ConsumerID))
+	}
+
+	if !query.Range.IsZero() {
+		conditions = append(conditions, "started_at >= "+arg(query.Range.From))
+
+		if query.Range.To != 0 {
+			conditions = append(conditions, "started_at <= "+arg(query.Range.To))
+		}
+	}
+
+	return conditions
+}
+
+// SummarizeLatencies aggregates the latencies on the database, so only their
+// summary is read. percentile_disc, unlike percentile_cont, does not
+// interpolate between two latencies, so the quantiles are the ones of
+// metrics.Histogram on the logs read by Query, within its 1%.
+func (d *postgres) SummarizeLatencies(query Query, quantiles []float64) (LatencySummary, error) {
+	var args []interface{}
+
+	arg := func(value interface{}) string {
+		args = append(args, value)
+
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conditions := postgresConditions(query, arg)
+	fractions := arg(pq.Array(quantiles)) + "::float8[]"
+
+	selected := []string{"count(*)"}
+
+	for _, latency := range []string{"request", "proxy", "gateway"} {
+		value := "GREATEST((latencies->>'" + latency + "')::bigint, 0)"
+
+		selected = append(selected,
+			"COALESCE(avg("+value+"), 0)",
+			"COALESCE(min("+value+"), 0)",
+			"COALESCE(max("+value+"), 0)",
+			"percentile_disc("+fractions+") WITHIN GROUP (ORDER BY "+value+")",
+		)
+	}
+
+	statement := `SELECT ` + strings.Join(selected, ", ") + ` FROM ` + quoteIdentifier(d.tableName)
+
+	if len(conditions) > 0 {
+		statement += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var summary LatencySummary
+
+	stats := []*LatencyStats{&summary.Request, &summary.Proxy, &summary.Gateway}
+	values := make([]pq.Int64Array, len(stats))
+	dest := []interface{}{&summary.Count}
+
+	for i, s := range stats {
+		dest = append(dest, &s.Avg, &s.Min, &s.Max, &values[i])
+	}
+
+	if err := d.db.QueryRow(statement, args...).Scan(dest...); err != nil {
+		return LatencySummary{}, err
+	}
+
+	// Without logs the quantiles are null, and 0 like on an empty histogram.
+	for i, s := range stats {
+		s.Quantiles = make([]int64, len(quantiles))
+		copy(s.Quantiles, values[i])
+	}
+
+	return summary, nil
+}
+
+func scanPostgresLog(rows *sql.Rows) (*apigateway.Log, error) {
+	var log apigateway.Log
+	var request, response, authenticatedEntity, route, service, latencies []byte
+
+	err := rows.Scan(
+		&request,
+		&log.UpstreamURI,
+		&response,
+		&authenticatedEntity,
+		&route,
+		&service,
+		&latencies,
+		&log.ClientIP,
+		&log.StartedAt,
+		&log.ServiceID,
+		&log.ConsumerID,
+		&log.ID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[*[]byte]interface{}{
+		&request:             &log.Request,
+		&response:            &log.Response,
+		&authenticatedEntity: &log.AuthenticatedEntity,
+		&route:               &log.Route,
+		&service:             &log.Service,
+		&latencies:           &log.Latencies,
+	}
+
+	for data, field := range fields {
+		if err = json.Unmarshal(*data, field); err != nil {
+			return nil, err
+		}
+	}
+
+	return &log, nil
+}
@@ -0,0 +1,42 @@
+package driver
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// rowKey is where a page of the SQL drivers stopped, their logs are ordered
+// by it, so the next page starts right after it.
+type rowKey struct {
+	StartedAt int64  `json:"started_at"`
+	ServiceID string `json:"service_id"`
+	ID        string `json:"id"`
+}
+
+func encodeRowKey(log *apigateway.Log) string {
+	data, _ := json.Marshal(rowKey{StartedAt: log.StartedAt, ServiceID: log.ServiceID, ID: log.ID})
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeRowKey(token string) (rowKey, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+
+	if err != nil {
+		return rowKey{}, ErrInvalidToken
+	}
+
+	var key *rowKey
+
+	if err = json.Unmarshal(data, &key); err != nil || key == nil {
+		return rowKey{}, ErrInvalidToken
+	}
+
+	return *key, nil
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,221 @@
+package driver
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	// Registers the "sqlite" database/sql driver, written in pure Go, so the
+	// binaries still build without cgo.
+	_ "modernc.org/sqlite"
+)
+
+type sqlite struct {
+	db        *sql.DB
+	tableName string
+}
+
+// NewSQLiteDriver stores the logs on the SQLite database at path, creating
+// the table and its indexes when they do not exist yet. Like on DynamoDB, a
+// log is keyed by its service, when it started and its ID.
+func NewSQLiteDriver(path string, tableName string) (ApiGatewayLogDriver, error) {
+	db, err := sql.Open("sqlite", path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite takes one writer at a time, so a single connection queues the
+	// writes of the parser workers instead of failing them as busy.
+	db.SetMaxOpenConns(1)
+
+	d := &sqlite{db: db, tableName: tableName}
+
+	if err = d.createTable(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *sqlite) createTable() error {
+	table := quoteIdentifier(d.tableName)
+
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS ` + table + ` (
+			service_id  TEXT NOT NULL,
+			started_at  INTEGER NOT NULL,
+			id          TEXT NOT NULL,
+			consumer_id TEXT NOT NULL,
+			log         TEXT NOT NULL,
+			PRIMARY KEY (service_id, started_at, id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS ` + quoteIdentifier(d.tableName+"_consumer_id") + ` ON ` + table + ` (consumer_id, started_at)`,
+		`CREATE INDEX IF NOT EXISTS ` + quoteIdentifier(d.tableName+"_started_at") + ` ON ` + table + ` (started_at)`,
+	}
+
+	for _, statement := range statements {
+		if _, err := d.db.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *sqlite) Add(log *apigateway.Log) error {
+	_, err := d.AddBatch(log)
+
+	return err
+}
+
+// AddBatch writes the logs on a single transaction, leaving out the ones
+// stored already, and returns how many were new.
+func (d *sqlite) AddBatch(logs ...*apigateway.Log) (int, error) {
+	tx, err := d.db.Begin()
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO ` + quoteIdentifier(d.tableName) + ` (service_id, started_at, id, consumer_id, log)
+		VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer stmt.Close()
+
+	added := 0
+
+	for _, log := range logs {
+		data, err := json.Marshal(log)
+
+		if err != nil {
+			return 0, err
+		}
+
+		result, err := stmt.Exec(log.ServiceID, log.StartedAt, log.ID, log.ConsumerID, string(data))
+
+		if err != nil {
+			return 0, err
+		}
+
+		rows, err := result.RowsAffected()
+
+		if err != nil {
+			return 0, err
+		}
+
+		added += int(rows)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return added, nil
+}
+
+func (d *sqlite) Client() interface{} {
+	return d.db
+}
+
+func (d *sqlite) GetTableName() string {
+	return d.tableName
+}
+
+// Query pages through the logs by the key of the last one returned, so the
+// pages are the same however many logs are added meanwhile before it.
+func (d *sqlite) Query(query Query, token string) (Page, error) {
+	var conditions []string
+	var args []interface{}
+
+	if query.ServiceID != "" {
+		conditions = append(conditions, "service_id = ?")
+		args = append(args, query.ServiceID)
+	} else if query.ConsumerID != "" {
+		conditions = append(conditions, "consumer_id = ?")
+		args = append(args, query.ConsumerID)
+	}
+
+	if !query.Range.IsZero() {
+		conditions = append(conditions, "started_at >= ?")
+		args = append(args, query.Range.From)
+
+		if query.Range.To != 0 {
+			conditions = append(conditions, "started_at <= ?")
+			args = append(args, query.Range.To)
+		}
+	}
+
+	if token != "" {
+		key, err := decodeRowKey(token)
+
+		if err != nil {
+			return Page{}, err
+		}
+
+		conditions = append(conditions, "(started_at, service_id, id) > (?, ?, ?)")
+		args = append(args, key.StartedAt, key.ServiceID, key.ID)
+	}
+
+	statement := `SELECT log FROM ` + quoteIdentifier(d.tableName)
+
+	if len(conditions) > 0 {
+		statement += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// A negative limit has no limit on SQLite.
+	limit := query.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+
+	statement += " ORDER BY started_at, service_id, id LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := d.db.Query(statement, args...)
+
+	if err != nil {
+		return Page{}, err
+	}
+
+	defer rows.Close()
+
+	var page Page
+
+	for rows.Next() {
+		var data string
+
+		if err = rows.Scan(&data); err != nil {
+			return Page{}, err
+		}
+
+		var log apigateway.Log
+
+		if err = json.Unmarshal([]byte(data), &log); err != nil {
+			return Page{}, err
+		}
+
+		page.Logs = append(page.Logs, &log)
+	}
+
+	if err = rows.Err(); err != nil {
+		return Page{}, err
+	}
+
+	// A full page may be followed by more logs, the next one tells.
+	if limit > 0 && len(page.Logs) == limit {
+		last := page.Logs[len(page.Logs)-1]
+
+		page.NextToken = encodeRowKey(last)
+	}
+
+	return page, nil
+}
@@ -0,0 +1,124 @@
+package driver
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	as "github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestSQLiteDriver(t *testing.T) ApiGatewayLogDriver {
+	dir, err := ioutil.TempDir("", "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	d, err := NewSQLiteDriver(filepath.Join(dir, "logs.db"), "apigateway-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+func TestSQLite_ShouldOnlyAddLogsNotStoredYet(t *testing.T) {
+	assert := as.New(t)
+
+	d := newTestSQLiteDriver(t)
+
+	logs := []*apigateway.Log{
+		{ServiceID: "s", StartedAt: 1, ID: "a", ClientIP: "0.0.0.0"},
+		{ServiceID: "s", StartedAt: 1, ID: "b"},
+	}
+
+	added, err := d.AddBatch(logs...)
+	assert.Nil(err)
+	assert.Equal(2, added)
+
+	added, err = d.AddBatch(append(logs, &apigateway.Log{ServiceID: "s", StartedAt: 1, ID: "c"})...)
+	assert.Nil(err)
+	assert.Equal(1, added)
+
+	page, err := d.Query(Query{ServiceID: "s"}, "")
+	assert.Nil(err)
+	assert.Len(page.Logs, 3)
+	assert.Equal(*logs[0], *page.Logs[0])
+	assert.Empty(page.NextToken)
+}
+
+func TestSQLite_ShouldQueryByServiceConsumerAndTimeRange(t *testing.T) {
+	assert := as.New(t)
+
+	d := newTestSQLiteDriver(t)
+
+	_, err := d.AddBatch(
+		&apigateway.Log{ServiceID: "s1", ConsumerID: "c1", StartedAt: 3, ID: "a"},
+		&apigateway.Log{ServiceID: "s1", ConsumerID: "c2", StartedAt: 1, ID: "b"},
+		&apigateway.Log{ServiceID: "s2", ConsumerID: "c1", StartedAt: 2, ID: "c"},
+		&apigateway.Log{ServiceID: "s2", ConsumerID: "c1", StartedAt: 5, ID: "d"},
+	)
+	assert.Nil(err)
+
+	ids := func(query Query) []string {
+		page, err := d.Query(query, "")
+		assert.Nil(err)
+
+		var ids []string
+		for _, log := range page.Logs {
+			ids = append(ids, log.ID)
+		}
+
+		return ids
+	}
+
+	assert.Equal([]string{"b", "a"}, ids(Query{ServiceID: "s1"}))
+	assert.Equal([]string{"c", "a", "d"}, ids(Query{ConsumerID: "c1"}))
+	assert.Equal([]string{"b", "c", "a", "d"}, ids(Query{}))
+	assert.Equal([]string{"c", "a"}, ids(Query{Range: apigateway.TimeRange{From: 2, To: 3}}))
+	assert.Equal([]string{"a", "d"}, ids(Query{ConsumerID: "c1", Range: apigateway.TimeRange{From: 3}}))
+}
+
+func TestSQLite_ShouldPageWithContinuationTokens(t *testing.T) {
+	assert := as.New(t)
+
+	d := newTestSQLiteDriver(t)
+
+	_, err := d.AddBatch(
+		&apigateway.Log{ServiceID: "s", StartedAt: 1, ID: "a"},
+		&apigateway.Log{ServiceID: "s", StartedAt: 1, ID: "b"},
+		&apigateway.Log{ServiceID: "s", StartedAt: 2, ID: "c"},
+	)
+	assert.Nil(err)
+
+	query := Query{ServiceID: "s", Limit: 2}
+
+	page, err := d.Query(query, "")
+	assert.Nil(err)
+	assert.Len(page.Logs, 2)
+	assert.NotEmpty(page.NextToken)
+
+	// A log added before the position is not returned on the next page.
+	assert.Nil(d.Add(&apigateway.Log{ServiceID: "s", StartedAt: 0, ID: "z"}))
+
+	page, err = d.Query(query, page.NextToken)
+	assert.Nil(err)
+	assert.Len(page.Logs, 1)
+	assert.Equal("c", page.Logs[0].ID)
+	assert.Empty(page.NextToken)
+}
+
+func TestSQLite_ShouldReturnErrorOnInvalidToken(t *testing.T) {
+	assert := as.New(t)
+
+	d := newTestSQLiteDriver(t)
+
+	for _, token := range []string{"not base64!", "bnVsbA"} {
+		_, err := d.Query(Query{ServiceID: "s"}, token)
+
+		assert.Same(ErrInvalidToken, err, token)
+	}
+}
@@ -15,14 +15,68 @@ func NewApiGatewayLogRepository(driver driver.ApiGatewayLogDriver) *ApiGatewayLo
 	}
 }
 
-func (a *ApiGatewayLogRepository) Add(log ...*apigateway.Log) error {
+// Cursor pages through the logs of a query. Each cursor keeps its own
+// position, so many of them can be read at the same time.
+type Cursor struct {
+	driver driver.ApiGatewayLogDriver
+	query  driver.Query
+	token  string
+	done   bool
+}
+
+// Next returns the next page of logs, or nil when there are no more.
+func (c *Cursor) Next() ([]*apigateway.Log, error) {
+	for !c.done {
+		page, err := c.driver.Query(c.query, c.token)
+
+		if err != nil {
+			return nil, err
+		}
+
+		c.token = page.NextToken
+		c.done = page.NextToken == ""
+
+		// A page may be empty and still not be the last one, e.g. when the
+		// logs it read were all out of the time range.
+		if len(page.Logs) > 0 {
+			return page.Logs, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Add writes the logs not stored yet and returns how many they were.
+func (a *ApiGatewayLogRepository) Add(log ...*apigateway.Log) (int, error) {
 	return a.driver.AddBatch(log...)
 }
 
-func (a *ApiGatewayLogRepository) GetByService(service string, limit int) ([]*apigateway.Log, error) {
-	return a.driver.GetByService(service, limit)
+func (a *ApiGatewayLogRepository) GetByService(service string, period apigateway.TimeRange, limit int) *Cursor {
+	return a.cursor(driver.Query{ServiceID: service, Range: period, Limit: limit})
+}
+
+func (a *ApiGatewayLogRepository) GetByConsumer(consumer string, period apigateway.TimeRange, limit int) *Cursor {
+	return a.cursor(driver.Query{ConsumerID: consumer, Range: period, Limit: limit})
+}
+
+func (a *ApiGatewayLogRepository) GetAll(period apigateway.TimeRange, limit int) *Cursor {
+	return a.cursor(driver.Query{Range: period, Limit: limit})
+}
+
+// SummarizeServiceLatencies has the driver aggregate the latencies of the
+// service, when it can. Otherwise ok is false, and the logs are to be read.
+func (a *ApiGatewayLogRepository) SummarizeServiceLatencies(service string, period apigateway.TimeRange, quantiles []float64) (summary driver.LatencySummary, ok bool, err error) {
+	aggregator, ok := a.driver.(driver.LatencyAggregator)
+
+	if !ok {
+		return driver.LatencySummary{}, false, nil
+	}
+
+	summary, err = aggregator.SummarizeLatencies(driver.Query{ServiceID: service, Range: period}, quantiles)
+
+	return summary, true, err
 }
 
-func (a *ApiGatewayLogRepository) GetByConsumer(consumer string, limit int) ([]*apigateway.Log, error) {
-	return a.driver.GetByConsumer(consumer, limit)
+func (a *ApiGatewayLogRepository) cursor(query driver.Query) *Cursor {
+	return &Cursor{driver: a.driver, query: query}
 }
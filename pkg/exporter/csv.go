@@ -0,0 +1,71 @@
+package exporter
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"bufio"
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+type csvExporter struct {
+	w        *csv.Writer
+	raw      *bufio.Writer
+	quoteAll bool
+	comma    string
+}
+
+func newCSVExporter(w io.Writer, columns []string, options apigateway.OutputOptions) (*csvExporter, error) {
+	delimiter := options.Delimiter
+
+	if delimiter == 0 {
+		delimiter = defaultDelimiter
+	}
+
+	e := &csvExporter{quoteAll: options.QuoteAll, comma: string(delimiter)}
+
+	// encoding/csv only quotes the fields that need it, so quoting all of
+	// them is written by hand.
+	if e.quoteAll {
+		e.raw = bufio.NewWriter(w)
+	} else {
+		e.w = csv.NewWriter(w)
+		e.w.Comma = delimiter
+	}
+
+	if options.NoHeader {
+		return e, nil
+	}
+
+	return e, e.Write(columns)
+}
+
+func (e *csvExporter) Write(row []string) error {
+	if !e.quoteAll {
+		return e.w.Write(row)
+	}
+
+	fields := make([]string, len(row))
+
+	for i, field := range row {
+		fields[i] = `"` + strings.Replace(field, `"`, `""`, -1) + `"`
+	}
+
+	_, err := e.raw.WriteString(strings.Join(fields, e.comma) + "\n")
+
+	return err
+}
+
+func (e *csvExporter) Flush() error {
+	if e.quoteAll {
+		return e.raw.Flush()
+	}
+
+	e.w.Flush()
+
+	return e.w.Error()
+}
+
+func (e *csvExporter) Close() error {
+	return e.Flush()
+}
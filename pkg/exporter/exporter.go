@@ -0,0 +1,51 @@
+package exporter
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"errors"
+	"io"
+)
+
+var ErrUnknownFormat = errors.New("unknown format, must be csv, json, jsonl or parquet")
+
+const defaultDelimiter = ';'
+
+// Exporter writes the rows of an export, all of them with the columns given
+// on its creation, on the format chosen.
+type Exporter interface {
+	Write(row []string) error
+	// Flush writes the rows buffered so far, when the format allows it.
+	Flush() error
+	// Close writes what is left, like the footer of the formats that have one.
+	Close() error
+}
+
+// New takes the type of each column, which the formats with types, like JSON,
+// write the values of the column as, whatever they look like.
+func New(w io.Writer, columns []string, types []apigateway.ColumnType, options apigateway.OutputOptions) (Exporter, error) {
+	switch options.Format {
+	case "", apigateway.FormatCSV:
+		return newCSVExporter(w, columns, options)
+	case apigateway.FormatJSON:
+		return newJSONExporter(w, columns, types), nil
+	case apigateway.FormatJSONLines:
+		return newJSONLinesExporter(w, columns, types), nil
+	case apigateway.FormatParquet:
+		return newParquetExporter(w, columns, types)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// Extension is the extension of the files on the format, it fails when the
+// format is unknown so exports can check it before doing any work.
+func Extension(options apigateway.OutputOptions) (string, error) {
+	switch options.Format {
+	case "":
+		return apigateway.FormatCSV, nil
+	case apigateway.FormatCSV, apigateway.FormatJSON, apigateway.FormatJSONLines, apigateway.FormatParquet:
+		return options.Format, nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
@@ -0,0 +1,186 @@
+package exporter
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"bytes"
+	as "github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+	"testing"
+)
+
+var (
+	testColumns = []string{"response.status", "route", "client_ip", "id"}
+	testTypes   = []apigateway.ColumnType{apigateway.ColumnNumber, apigateway.ColumnObject, apigateway.ColumnString, apigateway.ColumnString}
+	testRows    = [][]string{
+		{"200", `{"paths":["/orders"]}`, "0.0.0.0", "12345"},
+		{"502", `{"paths":[]}`, `say "hi"`, "a1"},
+	}
+)
+
+func export(t *testing.T, options apigateway.OutputOptions) string {
+	var b bytes.Buffer
+
+	exp, err := New(&b, testColumns, testTypes, options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, row := range testRows {
+		if err := exp.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := exp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.String()
+}
+
+func TestExporter_ShouldWriteCSV(t *testing.T) {
+	assert := as.New(t)
+
+	assert.Equal("response.status;route;client_ip;id\n"+
+		"200;\"{\"\"paths\"\":[\"\"/orders\"\"]}\";0.0.0.0;12345\n"+
+		"502;\"{\"\"paths\"\":[]}\";\"say \"\"hi\"\"\";a1\n", export(t, apigateway.OutputOptions{}))
+}
+
+func TestExporter_ShouldWriteCSVWithOptions(t *testing.T) {
+	assert := as.New(t)
+
+	options := apigateway.OutputOptions{Format: apigateway.FormatCSV, Delimiter: '\t', QuoteAll: true, NoHeader: true}
+
+	assert.Equal("\"200\"\t\"{\"\"paths\"\":[\"\"/orders\"\"]}\"\t\"0.0.0.0\"\t\"12345\"\n"+
+		"\"502\"\t\"{\"\"paths\"\":[]}\"\t\"say \"\"hi\"\"\"\t\"a1\"\n", export(t, options))
+}
+
+func TestExporter_ShouldWriteJSONLines(t *testing.T) {
+	assert := as.New(t)
+
+	// An ID that looks like a number is still a string.
+	assert.Equal(`{"response.status":200,"route":{"paths":["/orders"]},"client_ip":"0.0.0.0","id":"12345"}`+"\n"+
+		`{"response.status":502,"route":{"paths":[]},"client_ip":"say \"hi\"","id":"a1"}`+"\n",
+		export(t, apigateway.OutputOptions{Format: apigateway.FormatJSONLines}))
+}
+
+func TestExporter_ShouldWriteJSON(t *testing.T) {
+	assert := as.New(t)
+
+	assert.Equal(`[{"response.status":200,"route":{"paths":["/orders"]},"client_ip":"0.0.0.0","id":"12345"},`+
+		`{"response.status":502,"route":{"paths":[]},"client_ip":"say \"hi\"","id":"a1"}]`,
+		export(t, apigateway.OutputOptions{Format: apigateway.FormatJSON}))
+
+	var b bytes.Buffer
+
+	exp, _ := New(&b, testColumns, testTypes, apigateway.OutputOptions{Format: apigateway.FormatJSON})
+
+	assert.Nil(exp.Close())
+	assert.Equal("[]", b.String())
+}
+
+func TestExporter_ShouldWriteJSONByColumnType(t *testing.T) {
+	assert := as.New(t)
+
+	var b bytes.Buffer
+
+	columns := []string{"started_at", "route.preserve_host", "request", "host", "extra"}
+	types := []apigateway.ColumnType{apigateway.ColumnNumber, apigateway.ColumnBoolean, apigateway.ColumnObject, apigateway.ColumnString}
+
+	exp, _ := New(&b, columns, types, apigateway.OutputOptions{Format: apigateway.FormatJSONLines})
+
+	// Values that are not of the type of their column are null, and a column
+	// without a type is a string.
+	assert.Nil(exp.Write([]string{"12345", "true", `{"method":"GET"}`, "10", "1"}))
+	assert.Nil(exp.Write([]string{"", "yes", "GET", "", "[]"}))
+	assert.Nil(exp.Close())
+
+	assert.Equal(`{"started_at":12345,"route.preserve_host":true,"request":{"method":"GET"},"host":"10","extra":"1"}`+"\n"+
+		`{"started_at":null,"route.preserve_host":null,"request":null,"host":"","extra":"[]"}`+"\n", b.String())
+}
+
+func TestExporter_ShouldWriteParquet(t *testing.T) {
+	assert := as.New(t)
+
+	file, _ := buffer.NewBufferFile([]byte(export(t, apigateway.OutputOptions{Format: apigateway.FormatParquet})))
+
+	pr, err := reader.NewParquetColumnReader(file, 1)
+
+	assert.Nil(err)
+	assert.EqualValues(2, pr.GetNumRows())
+
+	var names []string
+
+	// the reader renames the columns to Go names, the ones on the file are
+	// kept as the external names.
+	for _, info := range pr.SchemaHandler.Infos[1:] {
+		names = append(names, info.ExName)
+	}
+
+	assert.Equal(testColumns, names)
+
+	values, _, _, err := pr.ReadColumnByIndex(2, 2)
+
+	assert.Nil(err)
+	assert.Equal([]interface{}{"0.0.0.0", `say "hi"`}, values)
+
+	// Numbers are read back as numbers, not as the strings of the rows.
+	values, _, _, err = pr.ReadColumnByIndex(0, 2)
+
+	assert.Nil(err)
+	assert.Equal([]interface{}{float64(200), float64(502)}, values)
+}
+
+func TestExporter_ShouldWriteParquetBooleansAndNulls(t *testing.T) {
+	assert := as.New(t)
+
+	var b bytes.Buffer
+
+	types := []apigateway.ColumnType{apigateway.ColumnBoolean, apigateway.ColumnNumber}
+	exp, err := New(&b, []string{"route.preserve_host", "avg"}, types, apigateway.OutputOptions{Format: apigateway.FormatParquet})
+
+	assert.Nil(err)
+	assert.Nil(exp.Write([]string{"true", "1.5"}))
+	assert.Nil(exp.Write([]string{"", ""}))
+	assert.Nil(exp.Close())
+
+	file, _ := buffer.NewBufferFile(b.Bytes())
+
+	pr, err := reader.NewParquetColumnReader(file, 1)
+
+	assert.Nil(err)
+
+	values, _, _, err := pr.ReadColumnByIndex(0, 2)
+
+	assert.Nil(err)
+	assert.Equal([]interface{}{true, nil}, values)
+
+	values, _, _, err = pr.ReadColumnByIndex(1, 2)
+
+	assert.Nil(err)
+	assert.Equal([]interface{}{1.5, nil}, values)
+
+	// A value that is not of its column's type is not written as a zero.
+	exp, _ = New(&bytes.Buffer{}, []string{"avg"}, types[1:], apigateway.OutputOptions{Format: apigateway.FormatParquet})
+
+	assert.NotNil(exp.Write([]string{"n/a"}))
+}
+
+func TestExporter_ShouldReturnErrorWithUnknownFormat(t *testing.T) {
+	assert := as.New(t)
+
+	_, err := New(&bytes.Buffer{}, testColumns, testTypes, apigateway.OutputOptions{Format: "xml"})
+
+	assert.Same(ErrUnknownFormat, err)
+
+	_, err = Extension(apigateway.OutputOptions{Format: "xml"})
+
+	assert.Same(ErrUnknownFormat, err)
+
+	extension, err := Extension(apigateway.OutputOptions{})
+
+	assert.Nil(err)
+	assert.Equal("csv", extension)
+}
@@ -0,0 +1,143 @@
+package exporter
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// jsonExporter writes the rows as an array of objects keyed by column.
+type jsonExporter struct {
+	w       *bufio.Writer
+	columns []string
+	types   []apigateway.ColumnType
+	rows    int
+}
+
+func newJSONExporter(w io.Writer, columns []string, types []apigateway.ColumnType) *jsonExporter {
+	return &jsonExporter{w: bufio.NewWriter(w), columns: columns, types: types}
+}
+
+func (e *jsonExporter) Write(row []string) error {
+	separator := ","
+
+	if e.rows == 0 {
+		separator = "["
+	}
+
+	e.rows++
+
+	_, err := e.w.WriteString(separator)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = e.w.Write(jsonObject(e.columns, e.types, row))
+
+	return err
+}
+
+func (e *jsonExporter) Flush() error {
+	return e.w.Flush()
+}
+
+func (e *jsonExporter) Close() error {
+	end := "]"
+
+	if e.rows == 0 {
+		end = "[]"
+	}
+
+	_, err := e.w.WriteString(end)
+
+	if err != nil {
+		return err
+	}
+
+	return e.Flush()
+}
+
+// jsonLinesExporter writes an object keyed by column for each row, one per
+// line.
+type jsonLinesExporter struct {
+	w       *bufio.Writer
+	columns []string
+	types   []apigateway.ColumnType
+}
+
+func newJSONLinesExporter(w io.Writer, columns []string, types []apigateway.ColumnType) *jsonLinesExporter {
+	return &jsonLinesExporter{w: bufio.NewWriter(w), columns: columns, types: types}
+}
+
+func (e *jsonLinesExporter) Write(row []string) error {
+	_, err := e.w.Write(append(jsonObject(e.columns, e.types, row), '\n'))
+
+	return err
+}
+
+func (e *jsonLinesExporter) Flush() error {
+	return e.w.Flush()
+}
+
+func (e *jsonLinesExporter) Close() error {
+	return e.Flush()
+}
+
+// jsonObject keeps the columns in order, each value written as the type of
+// its column, so a column has the same JSON type on every row. A column
+// without a type is a string.
+func jsonObject(columns []string, types []apigateway.ColumnType, row []string) []byte {
+	var buffer bytes.Buffer
+
+	buffer.WriteByte('{')
+
+	for i, column := range columns {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+
+		columnType := apigateway.ColumnString
+
+		if i < len(types) {
+			columnType = types[i]
+		}
+
+		key, _ := json.Marshal(column)
+		buffer.Write(key)
+		buffer.WriteByte(':')
+		buffer.Write(jsonValue(row[i], columnType))
+	}
+
+	buffer.WriteByte('}')
+
+	return buffer.Bytes()
+}
+
+// jsonValue writes the numbers, booleans and objects as they are, or as null
+// when the value is not one, e.g. an empty one.
+func jsonValue(value string, columnType apigateway.ColumnType) []byte {
+	valid := false
+
+	switch columnType {
+	case apigateway.ColumnString:
+		data, _ := json.Marshal(value)
+		return data
+	case apigateway.ColumnNumber:
+		_, err := strconv.ParseFloat(value, 64)
+		valid = err == nil && json.Valid([]byte(value))
+	case apigateway.ColumnBoolean:
+		valid = value == "true" || value == "false"
+	case apigateway.ColumnObject:
+		valid = value != "" && (value[0] == '{' || value[0] == '[') && json.Valid([]byte(value))
+	}
+
+	if !valid {
+		return []byte("null")
+	}
+
+	return []byte(value)
+}
@@ -0,0 +1,79 @@
+package exporter
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// parquetExporter writes each column with the type of its field: numbers as
+// DOUBLE, as some metrics are not whole, booleans as BOOLEAN and the rest as
+// UTF8 strings, objects as their JSON. An empty number or boolean is null.
+// Its rows are only written on Close, with the footer.
+type parquetExporter struct {
+	w     *writer.CSVWriter
+	types []apigateway.ColumnType
+}
+
+func newParquetExporter(w io.Writer, columns []string, types []apigateway.ColumnType) (*parquetExporter, error) {
+	schema := make([]string, len(columns))
+
+	for i, column := range columns {
+		switch types[i] {
+		case apigateway.ColumnNumber:
+			schema[i] = fmt.Sprintf("name=%s, type=DOUBLE, repetitiontype=OPTIONAL", column)
+		case apigateway.ColumnBoolean:
+			schema[i] = fmt.Sprintf("name=%s, type=BOOLEAN, repetitiontype=OPTIONAL", column)
+		default:
+			schema[i] = fmt.Sprintf("name=%s, type=UTF8, encoding=PLAIN_DICTIONARY", column)
+		}
+	}
+
+	pw, err := writer.NewCSVWriterFromWriter(schema, w, 1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &parquetExporter{w: pw, types: types}, nil
+}
+
+func (e *parquetExporter) Write(row []string) error {
+	values := make([]interface{}, len(row))
+
+	for i, value := range row {
+		v, err := parquetValue(value, e.types[i])
+
+		if err != nil {
+			return fmt.Errorf("column %d: %w", i+1, err)
+		}
+
+		values[i] = v
+	}
+
+	return e.w.Write(values)
+}
+
+func parquetValue(value string, columnType apigateway.ColumnType) (interface{}, error) {
+	switch {
+	case columnType == apigateway.ColumnNumber && value != "":
+		return strconv.ParseFloat(value, 64)
+	case columnType == apigateway.ColumnBoolean && value != "":
+		return strconv.ParseBool(value)
+	case columnType == apigateway.ColumnNumber, columnType == apigateway.ColumnBoolean:
+		return nil, nil
+	default:
+		return value, nil
+	}
+}
+
+func (e *parquetExporter) Flush() error {
+	return nil
+}
+
+func (e *parquetExporter) Close() error {
+	return e.w.WriteStop()
+}
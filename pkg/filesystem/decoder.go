@@ -0,0 +1,101 @@
+package filesystem
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+type decoder struct {
+	io.Reader
+	close func() error
+}
+
+func (d *decoder) Close() error {
+	return d.close()
+}
+
+// Decompress wraps the file with the decompressor matching its extension, or
+// its magic bytes when the extension is unknown. Plain files are returned as
+// they are, so they can still be seeked.
+func Decompress(file *os.File, path string) (io.ReadCloser, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz", ".gzip":
+		return newGzipDecoder(file, file)
+	case ".zst", ".zstd":
+		return newZstdDecoder(file, file)
+	}
+
+	head := make([]byte, len(zstdMagic))
+
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+
+	head = head[:n]
+
+	_, err = file.Seek(0, io.SeekStart)
+
+	// Files that cannot be seeked, like pipes, get the sniffed bytes back in
+	// front of the rest of the stream.
+	if err != nil {
+		return decompressByMagic(io.MultiReader(bytes.NewReader(head), file), head, file)
+	}
+
+	return decompressByMagic(file, head, file)
+}
+
+func decompressByMagic(r io.Reader, head []byte, file *os.File) (io.ReadCloser, error) {
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return newGzipDecoder(r, file)
+	case bytes.HasPrefix(head, zstdMagic):
+		return newZstdDecoder(r, file)
+	}
+
+	if r == io.Reader(file) {
+		return file, nil
+	}
+
+	return &decoder{Reader: r, close: file.Close}, nil
+}
+
+func newGzipDecoder(r io.Reader, file *os.File) (io.ReadCloser, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decoder{
+		Reader: gz,
+		close: func() error {
+			gz.Close()
+			return file.Close()
+		},
+	}, nil
+}
+
+func newZstdDecoder(r io.Reader, file *os.File) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decoder{
+		Reader: zr,
+		close: func() error {
+			zr.Close()
+			return file.Close()
+		},
+	}, nil
+}
@@ -1,13 +1,33 @@
 package filesystem
 
 import (
-	"bufio"
-	"os"
+	"errors"
+	"io"
 )
 
+const (
+	Stdin  = "-"
+	Stdout = "-"
+)
+
+var ErrNoFilesFound = errors.New("no files found")
+
+// File is written to a temporary file, which only replaces the path on
+// Commit, so a failed write never leaves a partial file behind. Abort drops
+// what was written, and does nothing after Commit.
+type File interface {
+	io.Writer
+	Commit() error
+	Abort() error
+}
+
 type API interface {
-	Open(path string) (*os.File, error)
-	GetScanner(file *os.File) *bufio.Scanner
-	GetLine(scanner *bufio.Scanner) string
-	Write(path string, data string) error
+	Open(path string) (io.ReadCloser, error)
+	Resolve(pattern string) ([]string, error)
+	Create(path string) (File, error)
+	OpenWriter(path string, truncate bool) (io.WriteCloser, error)
+	IsDir(path string) bool
+	Read(path string) (string, error)
+	Replace(path string, data string) error
+	Fingerprint(path string) (string, error)
 }
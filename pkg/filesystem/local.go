@@ -2,17 +2,28 @@ package filesystem
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 )
 
+const fingerprintSize = 64 * 1024
+
 type Local struct{}
 
 func NewLocalFileSystem() *Local {
 	return &Local{}
 }
 
-func (l *Local) Open(path string) (*os.File, error) {
+func (l *Local) Open(path string) (io.ReadCloser, error) {
+	if path == Stdin {
+		return Decompress(os.Stdin, path)
+	}
+
 	absPath, _ := filepath.Abs(path)
 
 	file, err := os.Open(absPath)
@@ -21,29 +32,197 @@ func (l *Local) Open(path string) (*os.File, error) {
 		return nil, err
 	}
 
-	return file, nil
+	r, err := Decompress(file, absPath)
+
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return r, nil
 }
 
-func (l *Local) GetScanner(file *os.File) *bufio.Scanner {
-	return bufio.NewScanner(file)
+func (l *Local) Resolve(pattern string) ([]string, error) {
+	if pattern == Stdin {
+		return []string{Stdin}, nil
+	}
+
+	info, err := os.Stat(pattern)
+
+	if err == nil && !info.IsDir() {
+		return []string{pattern}, nil
+	}
+
+	var paths []string
+
+	if err == nil {
+		files, err := ioutil.ReadDir(pattern)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			if !file.IsDir() {
+				paths = append(paths, filepath.Join(pattern, file.Name()))
+			}
+		}
+	} else {
+		paths, err = filepath.Glob(pattern)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil, ErrNoFilesFound
+	}
+
+	sort.Strings(paths)
+
+	return paths, nil
 }
 
-func (l *Local) GetLine(scanner *bufio.Scanner) string {
-	return scanner.Text()
+// Create writes the file on its directory, so it can be renamed to the path,
+// with a buffer kept until Commit. Stdout is written as it goes.
+func (l *Local) Create(path string) (File, error) {
+	if path == Stdout {
+		return &stdoutFile{Writer: bufio.NewWriter(os.Stdout)}, nil
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+
+	if err != nil {
+		return nil, err
+	}
+
+	f := &localFile{Writer: bufio.NewWriter(file), file: file, path: path}
+
+	if err = file.Chmod(0644); err != nil {
+		f.Abort()
+		return nil, err
+	}
+
+	return f, nil
 }
 
-func (l *Local) Write(path string, data string) error {
-	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// OpenWriter writes the path as it goes, after what it already has unless
+// truncate empties it first.
+func (l *Local) OpenWriter(path string, truncate bool) (io.WriteCloser, error) {
+	flags := os.O_APPEND | os.O_CREATE | os.O_WRONLY
+
+	if truncate {
+		flags |= os.O_TRUNC
+	}
+
+	return os.OpenFile(path, flags, 0644)
+}
+
+func (l *Local) IsDir(path string) bool {
+	info, err := os.Stat(path)
+
+	return err == nil && info.IsDir()
+}
+
+func (l *Local) Read(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func (l *Local) Replace(path string, data string) error {
+	tmp := path + ".tmp"
+
+	err := ioutil.WriteFile(tmp, []byte(data), 0644)
 
 	if err != nil {
 		return err
 	}
 
-	defer f.Close()
+	return os.Rename(tmp, path)
+}
+
+func (l *Local) Fingerprint(path string) (string, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+
+	if _, err = io.CopyN(hash, file, fingerprintSize); err != nil && err != io.EOF {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+type localFile struct {
+	*bufio.Writer
+	file *os.File
+	path string
+	done bool
+}
+
+func (f *localFile) Commit() error {
+	if f.done {
+		return nil
+	}
+
+	err := f.Flush()
 
-	if _, err = f.WriteString(data); err != nil {
+	if err == nil {
+		err = f.file.Sync()
+	}
+
+	if err != nil {
+		f.Abort()
 		return err
 	}
 
+	f.done = true
+
+	err = f.file.Close()
+
+	if err == nil {
+		err = os.Rename(f.file.Name(), f.path)
+	}
+
+	if err != nil {
+		os.Remove(f.file.Name())
+	}
+
+	return err
+}
+
+func (f *localFile) Abort() error {
+	if f.done {
+		return nil
+	}
+
+	f.done = true
+	f.file.Close()
+
+	return os.Remove(f.file.Name())
+}
+
+type stdoutFile struct {
+	*bufio.Writer
+}
+
+func (f *stdoutFile) Commit() error {
+	return f.Flush()
+}
+
+// Abort cannot take back what was already written to stdout.
+func (f *stdoutFile) Abort() error {
 	return nil
 }
@@ -0,0 +1,176 @@
+package filesystem
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	as "github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const content = "{\"started_at\":1}\n{\"started_at\":2}\n"
+
+func gzipContent(t *testing.T) []byte {
+	var buffer bytes.Buffer
+
+	w := gzip.NewWriter(&buffer)
+	_, err := w.Write([]byte(content))
+	as.Nil(t, err)
+	as.Nil(t, w.Close())
+
+	return buffer.Bytes()
+}
+
+func zstdContent(t *testing.T) []byte {
+	var buffer bytes.Buffer
+
+	w, err := zstd.NewWriter(&buffer)
+	as.Nil(t, err)
+	_, err = w.Write([]byte(content))
+	as.Nil(t, err)
+	as.Nil(t, w.Close())
+
+	return buffer.Bytes()
+}
+
+func readAll(t *testing.T, path string) string {
+	r, err := NewLocalFileSystem().Open(path)
+	as.Nil(t, err)
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	as.Nil(t, err)
+
+	return string(data)
+}
+
+func TestLocal_ShouldDecompressByExtensionAndMagicBytes(t *testing.T) {
+	assert := as.New(t)
+
+	dir, err := ioutil.TempDir("", "logs")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	files := map[string][]byte{
+		"access.log":        []byte(content),
+		"access.log.gz":     gzipContent(t),
+		"access.log.zst":    zstdContent(t),
+		"access.log.1":      gzipContent(t),
+		"access.log.2":      zstdContent(t),
+		"access.log.empty":  {},
+		"access.log.binary": {0x1f},
+	}
+
+	for name, data := range files {
+		assert.Nil(ioutil.WriteFile(filepath.Join(dir, name), data, 0644))
+	}
+
+	for name := range files {
+		expected := content
+
+		switch name {
+		case "access.log.empty":
+			expected = ""
+		case "access.log.binary":
+			expected = "\x1f"
+		}
+
+		assert.Equal(expected, readAll(t, filepath.Join(dir, name)), name)
+	}
+}
+
+func TestLocal_ShouldKeepPlainFilesSeekable(t *testing.T) {
+	assert := as.New(t)
+
+	file, err := ioutil.TempFile("", "logs")
+	assert.Nil(err)
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(content)
+	assert.Nil(err)
+
+	r, err := NewLocalFileSystem().Open(file.Name())
+	assert.Nil(err)
+	defer r.Close()
+
+	assert.IsType(&os.File{}, r)
+}
+
+func TestLocal_ShouldResolveDirectoriesAndGlobs(t *testing.T) {
+	assert := as.New(t)
+
+	dir, err := ioutil.TempDir("", "logs")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"b.log.gz", "a.log.gz", "c.txt"} {
+		assert.Nil(ioutil.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	assert.Nil(os.Mkdir(filepath.Join(dir, "archive"), 0755))
+
+	l := NewLocalFileSystem()
+
+	paths, err := l.Resolve(dir)
+	assert.Nil(err)
+	assert.Equal([]string{
+		filepath.Join(dir, "a.log.gz"),
+		filepath.Join(dir, "b.log.gz"),
+		filepath.Join(dir, "c.txt"),
+	}, paths)
+
+	paths, err = l.Resolve(filepath.Join(dir, "*.gz"))
+	assert.Nil(err)
+	assert.Equal([]string{filepath.Join(dir, "a.log.gz"), filepath.Join(dir, "b.log.gz")}, paths)
+
+	paths, err = l.Resolve(filepath.Join(dir, "c.txt"))
+	assert.Nil(err)
+	assert.Equal([]string{filepath.Join(dir, "c.txt")}, paths)
+
+	_, err = l.Resolve(filepath.Join(dir, "*.zst"))
+	assert.Same(ErrNoFilesFound, err)
+}
+
+func TestLocal_ShouldReplaceTheFileOnlyOnCommit(t *testing.T) {
+	assert := as.New(t)
+
+	dir, err := ioutil.TempDir("", "exports")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "export.csv")
+	assert.Nil(ioutil.WriteFile(path, []byte("old\n"), 0644))
+
+	l := NewLocalFileSystem()
+
+	file, err := l.Create(path)
+	assert.Nil(err)
+
+	_, err = file.Write([]byte("half"))
+	assert.Nil(err)
+	assert.Nil(file.Abort())
+
+	data, err := l.Read(path)
+	assert.Nil(err)
+	assert.Equal("old\n", data)
+
+	file, err = l.Create(path)
+	assert.Nil(err)
+
+	_, err = file.Write([]byte("new\n"))
+	assert.Nil(err)
+	assert.Nil(file.Commit())
+	assert.Nil(file.Abort())
+
+	data, err = l.Read(path)
+	assert.Nil(err)
+	assert.Equal("new\n", data)
+
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(err)
+	assert.Len(files, 1)
+	assert.Equal(os.FileMode(0644), files[0].Mode().Perm())
+}
@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"math"
+	"math/bits"
+)
+
+const (
+	subBucketBits  = 7
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount / 2
+)
+
+// Histogram is a log-linear histogram, like an HDR histogram: values below 128
+// are counted exactly and bigger ones in buckets 1/128 of their magnitude
+// wide. Its memory is bounded by the magnitude of the values, not by how many
+// are recorded, and quantiles are within 1% of the real value.
+type Histogram struct {
+	counts []uint64
+	count  uint64
+	sum    int64
+	min    int64
+	max    int64
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+func (h *Histogram) Record(value int64) {
+	if value < 0 {
+		value = 0
+	}
+
+	index := bucketIndex(value)
+
+	if index >= len(h.counts) {
+		counts := make([]uint64, index+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+
+	h.counts[index]++
+
+	if h.count == 0 || value < h.min {
+		h.min = value
+	}
+
+	if value > h.max {
+		h.max = value
+	}
+
+	h.count++
+	h.sum += value
+}
+
+func (h *Histogram) Count() uint64 {
+	return h.count
+}
+
+func (h *Histogram) Sum() int64 {
+	return h.sum
+}
+
+func (h *Histogram) Min() int64 {
+	return h.min
+}
+
+func (h *Histogram) Max() int64 {
+	return h.max
+}
+
+func (h *Histogram) Mean() float64 {
+	if h.count == 0 {
+		return 0
+	}
+
+	return float64(h.sum) / float64(h.count)
+}
+
+// Quantile returns the value below which the q fraction of the recorded
+// values fall, e.g. 0.95 for the p95.
+func (h *Histogram) Quantile(q float64) int64 {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(h.count)))
+
+	if rank < 1 {
+		rank = 1
+	}
+
+	if rank > h.count {
+		rank = h.count
+	}
+
+	var seen uint64
+
+	for i, c := range h.counts {
+		seen += c
+
+		if seen >= rank {
+			return h.clamp(bucketValue(i))
+		}
+	}
+
+	return h.max
+}
+
+func (h *Histogram) clamp(value int64) int64 {
+	if value < h.min {
+		return h.min
+	}
+
+	if value > h.max {
+		return h.max
+	}
+
+	return value
+}
+
+func bucketIndex(value int64) int {
+	if value < subBucketCount {
+		return int(value)
+	}
+
+	shift := bits.Len64(uint64(value)) - subBucketBits
+
+	return shift*subBucketHalf + int(value>>uint(shift))
+}
+
+// bucketValue is the middle of the values counted on the bucket.
+func bucketValue(index int) int64 {
+	if index < subBucketCount {
+		return int64(index)
+	}
+
+	shift := index/subBucketHalf - 1
+	lower := int64(index-shift*subBucketHalf) << uint(shift)
+
+	return lower + (int64(1)<<uint(shift))/2
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	as "github.com/stretchr/testify/assert"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestHistogram_ShouldReturnExactQuantilesForSmallValues(t *testing.T) {
+	assert := as.New(t)
+
+	h := NewHistogram()
+
+	for i := int64(1); i <= 100; i++ {
+		h.Record(i)
+	}
+
+	assert.EqualValues(100, h.Count())
+	assert.EqualValues(1, h.Min())
+	assert.EqualValues(100, h.Max())
+	assert.Equal(50.5, h.Mean())
+	assert.EqualValues(50, h.Quantile(0.5))
+	assert.EqualValues(90, h.Quantile(0.9))
+	assert.EqualValues(95, h.Quantile(0.95))
+	assert.EqualValues(99, h.Quantile(0.99))
+	assert.EqualValues(100, h.Quantile(1))
+}
+
+func TestHistogram_ShouldReturnQuantilesWithinOnePercent(t *testing.T) {
+	assert := as.New(t)
+
+	random := rand.New(rand.NewSource(42))
+
+	h := NewHistogram()
+
+	var values []int64
+
+	for i := 0; i < 100000; i++ {
+		value := int64(random.ExpFloat64() * 2000)
+		values = append(values, value)
+		h.Record(value)
+	}
+
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	for _, q := range []float64{0.5, 0.9, 0.95, 0.99} {
+		expected := values[int(math.Ceil(q*float64(len(values))))-1]
+
+		assert.InEpsilon(expected, h.Quantile(q), 0.01, "quantile %v", q)
+	}
+
+	assert.Equal(values[len(values)-1], h.Max())
+	assert.Equal(values[len(values)-1], h.Quantile(1))
+}
+
+func TestHistogram_ShouldReturnZeroWhenEmpty(t *testing.T) {
+	assert := as.New(t)
+
+	h := NewHistogram()
+
+	assert.EqualValues(0, h.Quantile(0.5))
+	assert.EqualValues(0, h.Mean())
+	assert.EqualValues(0, h.Min())
+	assert.EqualValues(0, h.Max())
+}
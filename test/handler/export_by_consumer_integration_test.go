@@ -7,6 +7,7 @@ import (
 	"api-gateway-log-parser/application/service"
 	"api-gateway-log-parser/pkg/apigateway"
 	"api-gateway-log-parser/pkg/apigateway/repository"
+	"api-gateway-log-parser/pkg/apigateway/repository/driver"
 	mock "api-gateway-log-parser/test/mocks"
 	"context"
 	"errors"
@@ -26,7 +27,7 @@ func TestHandleExportByConsumer_ShouldReturnErrorWithWrongParameters(t *testing.
 
 	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
 
-	h := handler.NewExportByConsumerHandler(s)
+	h := handler.NewExportByConsumerHandler(storedService(s))
 
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
@@ -55,8 +56,6 @@ func TestHandleExportByConsumer_ShouldExportLogs(t *testing.T) {
 	consumerID := "c3e86413-648a-3552-90c3-b13491ee07d6"
 	userIP := "0.0.0.0"
 
-	itemsPerPage := 1000
-
 	logs = append(logs, &apigateway.Log{
 		Request:             apigateway.Request{},
 		UpstreamURI:         "/",
@@ -86,16 +85,15 @@ func TestHandleExportByConsumer_ShouldExportLogs(t *testing.T) {
 	})
 
 	filesystem := mock.FileSystemMock{}
-	filesystem.On("Write", m.Anything, m.Anything).Return(nil).Twice()
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", m.Anything).Return(nil).Once()
 
-	driverMock := mock.DriverMock{}
-	driverMock.On("GetByConsumer", consumerID, itemsPerPage).Return(logs).Twice()
-
-	repo := repository.NewApiGatewayLogRepository(&driverMock)
+	repo := newMemoryRepository(t, logs...)
 
 	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
 
-	h := handler.NewExportByConsumerHandler(s)
+	h := handler.NewExportByConsumerHandler(storedService(s))
 
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
@@ -135,16 +133,20 @@ func TestHandleExportByConsumer_ShouldPaginateLogs(t *testing.T) {
 	}
 
 	filesystem := mock.FileSystemMock{}
-	filesystem.On("Write", m.Anything, m.Anything).Return(nil).Times(3)
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", m.Anything).Return(nil).Once()
 
 	driverMock := mock.DriverMock{}
-	driverMock.On("GetByConsumer", consumerID, itemsPerPage).Return(logs).Times(3)
+	query := driver.Query{ConsumerID: consumerID, Limit: itemsPerPage}
+	driverMock.On("Query", query, "").Return(driver.Page{Logs: logs, NextToken: "next"}, nil).Once()
+	driverMock.On("Query", query, "next").Return(driver.Page{Logs: logs}, nil).Once()
 
 	repo := repository.NewApiGatewayLogRepository(&driverMock)
 
 	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
 
-	h := handler.NewExportByConsumerHandler(s)
+	h := handler.NewExportByConsumerHandler(storedService(s))
 
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
@@ -164,17 +166,18 @@ func TestHandleExportByConsumer_ShouldReturnErrorOnGettingLogs(t *testing.T) {
 	itemsPerPage := 1000
 
 	filesystem := mock.FileSystemMock{}
-	filesystem.On("Write", m.Anything, m.Anything).Return(nil).Twice()
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
 
 	driverErr := errors.New("error on getting logs")
 	driverMock := mock.DriverMock{}
-	driverMock.On("GetByConsumer", consumerID, itemsPerPage).Return(nil, driverErr).Twice()
+	driverMock.On("Query", driver.Query{ConsumerID: consumerID, Limit: itemsPerPage}, "").Return(driver.Page{}, driverErr).Once()
 
 	repo := repository.NewApiGatewayLogRepository(&driverMock)
 
 	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
 
-	h := handler.NewExportByConsumerHandler(s)
+	h := handler.NewExportByConsumerHandler(storedService(s))
 
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
@@ -193,20 +196,17 @@ func TestHandleExportByConsumer_ShouldReturnErrorOnWritingLogs(t *testing.T) {
 	consumerID := "c3e86413-648a-3552-90c3-b13491ee07d6"
 	var logs []*apigateway.Log
 
-	itemsPerPage := 1000
-
 	filesystemErr := errors.New("error on writing logs")
 	filesystem := mock.FileSystemMock{}
-	filesystem.On("Write", m.Anything, m.Anything).Return(filesystemErr).Twice()
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", m.Anything).Return(filesystemErr).Once()
 
-	driverMock := mock.DriverMock{}
-	driverMock.On("GetByConsumer", consumerID, itemsPerPage).Return(logs, nil).Twice()
-
-	repo := repository.NewApiGatewayLogRepository(&driverMock)
+	repo := newMemoryRepository(t, logs...)
 
 	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
 
-	h := handler.NewExportByConsumerHandler(s)
+	h := handler.NewExportByConsumerHandler(storedService(s))
 
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
@@ -218,3 +218,95 @@ func TestHandleExportByConsumer_ShouldReturnErrorOnWritingLogs(t *testing.T) {
 	assert.NotNil(err)
 	assert.Same(filesystemErr, err)
 }
+
+func TestHandleExportByConsumer_ShouldExportLogsByTimeRange(t *testing.T) {
+	assert := as.New(t)
+
+	consumerID := "29a5a16b-e4fa-331f-9f1c-5adea563d7de"
+
+	logs := []*apigateway.Log{
+		{StartedAt: 1566655199999, ConsumerID: consumerID},
+		{StartedAt: 1566660387000, ConsumerID: consumerID},
+	}
+
+	filesystem := mock.FileSystemMock{}
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", "started_at\n1566660387000\n").Return(nil).Once()
+
+	repo := newMemoryRepository(t, logs...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportByConsumerHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--from", "2019-08-24T14:00:00Z", "--columns", "started_at", consumerID}
+
+	err := h.HandleExportByConsumer(context.Background())
+
+	assert.Nil(err)
+	file.AssertExpectations(t)
+}
+
+func TestHandleExportByConsumer_ShouldExportSelectedColumns(t *testing.T) {
+	assert := as.New(t)
+
+	consumerID := "29a5a16b-e4fa-331f-9f1c-5adea563d7de"
+
+	logs := []*apigateway.Log{{
+		Request:    apigateway.Request{Method: "GET"},
+		Response:   apigateway.Response{Status: 200},
+		StartedAt:  12345,
+		ConsumerID: consumerID,
+	}}
+
+	filesystem := mock.FileSystemMock{}
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", "started_at;response.status;request.method\n12345;200;GET\n").Return(nil).Once()
+
+	repo := newMemoryRepository(t, logs...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportByConsumerHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--columns", "started_at, response.status,request.method", consumerID}
+
+	err := h.HandleExportByConsumer(context.Background())
+
+	assert.Nil(err)
+	filesystem.AssertExpectations(t)
+	file.AssertExpectations(t)
+}
+
+func TestHandleExportByConsumer_ShouldReturnErrorWithUnknownColumn(t *testing.T) {
+	assert := as.New(t)
+
+	consumerID := "29a5a16b-e4fa-331f-9f1c-5adea563d7de"
+
+	filesystem := mock.FileSystemMock{}
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportByConsumerHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--columns", "started_at,response.code", consumerID}
+
+	err := h.HandleExportByConsumer(context.Background())
+
+	assert.True(errors.Is(err, apigateway.ErrUnknownColumn))
+	filesystem.AssertNotCalled(t, "Create", m.Anything)
+}
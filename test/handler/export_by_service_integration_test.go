@@ -7,12 +7,16 @@ import (
 	"api-gateway-log-parser/application/service"
 	"api-gateway-log-parser/pkg/apigateway"
 	"api-gateway-log-parser/pkg/apigateway/repository"
+	"api-gateway-log-parser/pkg/apigateway/repository/driver"
+	"api-gateway-log-parser/pkg/exporter"
 	mock "api-gateway-log-parser/test/mocks"
 	"context"
 	"errors"
 	as "github.com/stretchr/testify/assert"
 	m "github.com/stretchr/testify/mock"
+	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -26,7 +30,7 @@ func TestHandleExportByService_ShouldReturnErrorWithWrongParameters(t *testing.T
 
 	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
 
-	h := handler.NewExportByServiceHandler(s)
+	h := handler.NewExportByServiceHandler(storedService(s))
 
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
@@ -55,8 +59,6 @@ func TestHandleExportByService_ShouldExportLogs(t *testing.T) {
 	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
 	userIP := "0.0.0.0"
 
-	itemsPerPage := 1000
-
 	logs = append(logs, &apigateway.Log{
 		Request:             apigateway.Request{},
 		UpstreamURI:         "/",
@@ -86,16 +88,15 @@ func TestHandleExportByService_ShouldExportLogs(t *testing.T) {
 	})
 
 	filesystem := mock.FileSystemMock{}
-	filesystem.On("Write", m.Anything, m.Anything).Return(nil).Twice()
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", m.Anything).Return(nil).Once()
 
-	driverMock := mock.DriverMock{}
-	driverMock.On("GetByService", serviceID, itemsPerPage).Return(logs).Twice()
-
-	repo := repository.NewApiGatewayLogRepository(&driverMock)
+	repo := newMemoryRepository(t, logs...)
 
 	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
 
-	h := handler.NewExportByServiceHandler(s)
+	h := handler.NewExportByServiceHandler(storedService(s))
 
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
@@ -135,16 +136,20 @@ func TestHandleExportByService_ShouldPaginateLogs(t *testing.T) {
 	}
 
 	filesystem := mock.FileSystemMock{}
-	filesystem.On("Write", m.Anything, m.Anything).Return(nil).Times(3)
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", m.Anything).Return(nil).Once()
 
 	driverMock := mock.DriverMock{}
-	driverMock.On("GetByService", serviceID, itemsPerPage).Return(logs).Times(3)
+	query := driver.Query{ServiceID: serviceID, Limit: itemsPerPage}
+	driverMock.On("Query", query, "").Return(driver.Page{Logs: logs, NextToken: "next"}, nil).Once()
+	driverMock.On("Query", query, "next").Return(driver.Page{Logs: logs}, nil).Once()
 
 	repo := repository.NewApiGatewayLogRepository(&driverMock)
 
 	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
 
-	h := handler.NewExportByServiceHandler(s)
+	h := handler.NewExportByServiceHandler(storedService(s))
 
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
@@ -164,17 +169,18 @@ func TestHandleExportByService_ShouldReturnErrorOnGettingLogs(t *testing.T) {
 	itemsPerPage := 1000
 
 	filesystem := mock.FileSystemMock{}
-	filesystem.On("Write", m.Anything, m.Anything).Return(nil).Twice()
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
 
 	driverErr := errors.New("error on getting logs")
 	driverMock := mock.DriverMock{}
-	driverMock.On("GetByService", serviceID, itemsPerPage).Return(nil, driverErr).Twice()
+	driverMock.On("Query", driver.Query{ServiceID: serviceID, Limit: itemsPerPage}, "").Return(driver.Page{}, driverErr).Once()
 
 	repo := repository.NewApiGatewayLogRepository(&driverMock)
 
 	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
 
-	h := handler.NewExportByServiceHandler(s)
+	h := handler.NewExportByServiceHandler(storedService(s))
 
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
@@ -185,6 +191,7 @@ func TestHandleExportByService_ShouldReturnErrorOnGettingLogs(t *testing.T) {
 
 	assert.NotNil(err)
 	assert.Same(driverErr, err)
+	assert.True(file.Aborted)
 }
 
 func TestHandleExportByService_ShouldReturnErrorOnWritingLogs(t *testing.T) {
@@ -193,28 +200,370 @@ func TestHandleExportByService_ShouldReturnErrorOnWritingLogs(t *testing.T) {
 	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
 	var logs []*apigateway.Log
 
+	filesystemErr := errors.New("error on writing logs")
+	filesystem := mock.FileSystemMock{}
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", m.Anything).Return(filesystemErr).Once()
+
+	repo := newMemoryRepository(t, logs...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportByServiceHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", serviceID}
+
+	err := h.HandleExportByService(context.Background())
+
+	assert.NotNil(err)
+	assert.Same(filesystemErr, err)
+}
+
+func TestHandleExportByService_ShouldExportLogsByTimeRange(t *testing.T) {
+	assert := as.New(t)
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	logs := []*apigateway.Log{
+		{StartedAt: 1566655199999, ServiceID: serviceID},
+		{StartedAt: 1566660387000, ServiceID: serviceID},
+		{StartedAt: 1566662400001, ServiceID: serviceID},
+	}
+
+	filesystem := mock.FileSystemMock{}
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", "started_at\n1566660387000\n").Return(nil).Once()
+
+	repo := newMemoryRepository(t, logs...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportByServiceHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--from", "2019-08-24T14:00:00Z", "--to", "1566662400000", "--columns", "started_at", serviceID}
+
+	err := h.HandleExportByService(context.Background())
+
+	assert.Nil(err)
+	file.AssertExpectations(t)
+}
+
+func TestHandleExportByService_ShouldReturnErrorWithWrongTimeRange(t *testing.T) {
+	assert := as.New(t)
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	filesystem := mock.FileSystemMock{}
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportByServiceHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--from", "yesterday", serviceID}
+
+	err := h.HandleExportByService(context.Background())
+
+	assert.Same(handler.ErrInvalidTime, err)
+
+	os.Args = []string{"", "--from", "2019-08-24T15:00:00Z", "--to", "2019-08-24T14:00:00Z", serviceID}
+
+	err = h.HandleExportByService(context.Background())
+
+	assert.Same(handler.ErrInvalidTimeRange, err)
+}
+
+func TestHandleExportByService_ShouldExportFlattenedLogs(t *testing.T) {
+	assert := as.New(t)
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	logs := []*apigateway.Log{{
+		Request:   apigateway.Request{Method: "GET"},
+		Response:  apigateway.Response{Status: 200},
+		StartedAt: 12345,
+		ServiceID: serviceID,
+	}}
+
+	filesystem := mock.FileSystemMock{}
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", m.MatchedBy(func(data string) bool {
+		rows := strings.Split(data, "\n")
+
+		return strings.HasPrefix(rows[0], "request.method;request.uri;") &&
+			strings.HasPrefix(rows[1], "GET;") && strings.Contains(rows[1], ";200;")
+	})).Return(nil).Once()
+
+	repo := newMemoryRepository(t, logs...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportByServiceHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--flatten", serviceID}
+
+	err := h.HandleExportByService(context.Background())
+
+	assert.Nil(err)
+	filesystem.AssertExpectations(t)
+	file.AssertExpectations(t)
+}
+
+func TestHandleExportByService_ShouldExportJSONLines(t *testing.T) {
+	assert := as.New(t)
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	logs := []*apigateway.Log{{
+		Response:  apigateway.Response{Status: 200},
+		StartedAt: 12345,
+		ServiceID: serviceID,
+	}}
+
+	filesystem := mock.FileSystemMock{}
+	file := mock.FileMock{}
+	filesystem.On("Create", m.MatchedBy(func(path string) bool {
+		return strings.HasSuffix(path, ".jsonl")
+	})).Return(&file, nil).Once()
+	file.On("Commit", `{"started_at":12345,"response":{"status":200,"size":0,"headers":{"Content-Length":"","via":"","Connection":"","access-control-allow-credentials":"","Content-Type":"","server":"","access-control-allow-origin":""}}}`+"\n").Return(nil).Once()
+
+	repo := newMemoryRepository(t, logs...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportByServiceHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--format", "jsonl", "--columns", "started_at,response", serviceID}
+
+	err := h.HandleExportByService(context.Background())
+
+	assert.Nil(err)
+	filesystem.AssertExpectations(t)
+	file.AssertExpectations(t)
+}
+
+func TestHandleExportByService_ShouldReturnErrorWithWrongFormat(t *testing.T) {
+	assert := as.New(t)
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	filesystem := mock.FileSystemMock{}
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportByServiceHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--format", "xml", serviceID}
+
+	err := h.HandleExportByService(context.Background())
+
+	assert.Same(exporter.ErrUnknownFormat, err)
+
+	os.Args = []string{"", "--delimiter", ";;", serviceID}
+
+	err = h.HandleExportByService(context.Background())
+
+	assert.Same(handler.ErrInvalidDelimiter, err)
+}
+
+func TestHandleExportByService_ShouldExportToOutput(t *testing.T) {
+	assert := as.New(t)
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
 	itemsPerPage := 1000
 
-	filesystemErr := errors.New("error on writing logs")
+	logs := []*apigateway.Log{{StartedAt: 12345, ServiceID: serviceID}}
+
+	outputs := map[string][]string{
+		"exports/service-" + serviceID + ".csv": {"--output", "exports", "--filename", "{prefix}-{id}.{ext}"},
+		"exports/logs.csv":                      {"--output", "exports/logs.csv"},
+		"-":                                     {"--output", "-"},
+	}
+
+	for path, args := range outputs {
+		filesystem := mock.FileSystemMock{}
+		filesystem.On("IsDir", "exports").Return(true).Maybe()
+		filesystem.On("IsDir", "exports/logs.csv").Return(false).Maybe()
+		file := mock.FileMock{}
+		filesystem.On("Create", path).Return(&file, nil).Once()
+		file.On("Commit", m.Anything).Return(nil).Once()
+
+		driverMock := mock.DriverMock{}
+		driverMock.On("Query", driver.Query{ServiceID: serviceID, Limit: itemsPerPage}, "").Return(driver.Page{Logs: logs}, nil).Once()
+
+		repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+		s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+		h := handler.NewExportByServiceHandler(storedService(s))
+
+		oldArgs := os.Args
+
+		os.Args = append(append([]string{""}, args...), serviceID)
+
+		err := h.HandleExportByService(context.Background())
+
+		os.Args = oldArgs
+
+		assert.Nil(err, path)
+		filesystem.AssertExpectations(t)
+		file.AssertExpectations(t)
+	}
+}
+
+func TestHandleExportByService_ShouldExportManyTimesWithTheSameDriver(t *testing.T) {
+	assert := as.New(t)
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	itemsPerPage := 1000
+
+	logs := []*apigateway.Log{{StartedAt: 12345, ServiceID: serviceID}}
+
 	filesystem := mock.FileSystemMock{}
-	filesystem.On("Write", m.Anything, m.Anything).Return(filesystemErr).Twice()
 
 	driverMock := mock.DriverMock{}
-	driverMock.On("GetByService", serviceID, itemsPerPage).Return(logs, nil).Twice()
+	query := driver.Query{ServiceID: serviceID, Limit: itemsPerPage}
+	driverMock.On("Query", query, "").Return(driver.Page{Logs: logs, NextToken: "next"}, nil).Twice()
+	driverMock.On("Query", query, "next").Return(driver.Page{Logs: logs}, nil).Twice()
 
 	repo := repository.NewApiGatewayLogRepository(&driverMock)
 
 	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
 
-	h := handler.NewExportByServiceHandler(s)
+	h := handler.NewExportByServiceHandler(storedService(s))
 
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
 
-	os.Args = []string{"", serviceID}
+	os.Args = []string{"", "--no-header", serviceID}
+
+	for i := 0; i < 2; i++ {
+		file := mock.FileMock{}
+		filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+		file.On("Commit", m.MatchedBy(func(data string) bool {
+			return strings.Count(data, "\n") == 2
+		})).Return(nil).Once()
+
+		err := h.HandleExportByService(context.Background())
+
+		assert.Nil(err)
+		file.AssertExpectations(t)
+	}
+
+	driverMock.AssertExpectations(t)
+}
+
+func TestHandleExportByService_ShouldExportEphemeralLogs(t *testing.T) {
+	assert := as.New(t)
+
+	path := "logs.txt"
+
+	lines := []string{
+		`{"started_at":2,"service":{"id":"s"},"request":{"method":"POST"}}`,
+		`{"started_at":1,"service":{"id":"s"},"request":{"method":"GET"}}`,
+		`{"started_at":1,"service":{"id":"other"},"request":{"method":"GET"}}`,
+	}
+
+	// No checkpoint is written, nor read, for logs kept on memory.
+	filesystem := mock.FileSystemMock{}
+	filesystem.On("Resolve", path).Return([]string{path}, nil).Once()
+	filesystem.On("Open", path).Return(ioutil.NopCloser(strings.NewReader(strings.Join(lines, "\n")))).Once()
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", "started_at;request.method\n1;GET\n2;POST\n").Return(nil).Once()
+
+	// The database is not even opened.
+	stored := func() (apigateway.LogService, error) {
+		t.Fatal("an ephemeral run opens no database")
+
+		return nil, nil
+	}
+
+	ephemeral := handler.WithEphemeralService(func() (apigateway.LogService, error) {
+		d, _ := driver.NewMemoryDriver("apigateway-logs")
+
+		return service.NewApiGatewayLogParserService(repository.NewApiGatewayLogRepository(d), &filesystem)
+	})
+
+	h := handler.NewExportByServiceHandler(stored, ephemeral)
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--ephemeral", path, "--columns", "started_at,request.method", "s"}
 
 	err := h.HandleExportByService(context.Background())
 
-	assert.NotNil(err)
-	assert.Same(filesystemErr, err)
+	assert.Nil(err)
+	filesystem.AssertExpectations(t)
+	file.AssertExpectations(t)
+}
+
+func TestHandleExportByService_ShouldExportStoredLogsWithEmptyEphemeral(t *testing.T) {
+	assert := as.New(t)
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	filesystem := mock.FileSystemMock{}
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", "started_at\n1\n").Return(nil).Once()
+
+	driverMock := mock.DriverMock{}
+	driverMock.On("Query", driver.Query{ServiceID: serviceID, Limit: 1000}, "").Return(driver.Page{Logs: []*apigateway.Log{{StartedAt: 1, ServiceID: serviceID}}}, nil).Once()
+
+	s, _ := service.NewApiGatewayLogParserService(repository.NewApiGatewayLogRepository(&driverMock), &filesystem)
+
+	h := handler.NewExportByServiceHandler(storedService(s), handler.WithEphemeralService(func() (apigateway.LogService, error) {
+		t.Fatal("an empty --ephemeral runs on the stored logs")
+
+		return nil, nil
+	}))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--ephemeral=", "--columns", "started_at", serviceID}
+
+	err := h.HandleExportByService(context.Background())
+
+	assert.Nil(err)
+	file.AssertExpectations(t)
+
+	// Without a way to keep the logs on memory, there is no ephemeral run.
+	h = handler.NewExportByServiceHandler(storedService(s))
+
+	os.Args = []string{"", "--ephemeral", "logs.txt", serviceID}
+
+	err = h.HandleExportByService(context.Background())
+
+	assert.Same(handler.ErrEphemeralNotSupported, err)
 }
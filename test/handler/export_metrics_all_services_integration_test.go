@@ -0,0 +1,172 @@
+// +build integration
+
+package test
+
+import (
+	"api-gateway-log-parser/application/handler"
+	"api-gateway-log-parser/application/service"
+	"api-gateway-log-parser/pkg/apigateway"
+	"api-gateway-log-parser/pkg/apigateway/repository"
+	"api-gateway-log-parser/pkg/apigateway/repository/driver"
+	mock "api-gateway-log-parser/test/mocks"
+	"context"
+	"errors"
+	as "github.com/stretchr/testify/assert"
+	m "github.com/stretchr/testify/mock"
+	"os"
+	"strings"
+	"testing"
+)
+
+func getAllServicesLogs() []*apigateway.Log {
+	var logs []*apigateway.Log
+
+	for i := 1; i <= 3; i++ {
+		logs = append(logs, &apigateway.Log{
+			Service:   apigateway.Service{Name: "orders"},
+			Latencies: apigateway.Latencies{Proxy: i, Gateway: i, Request: i},
+			StartedAt: int64(12345 + i),
+			ServiceID: "c3e86413-648a-3552-90c3-b13491ee07d6",
+		})
+	}
+
+	logs = append(logs, &apigateway.Log{
+		Service:   apigateway.Service{Name: "payments"},
+		Latencies: apigateway.Latencies{Proxy: 10, Gateway: 10, Request: 10},
+		StartedAt: 12345,
+		ServiceID: "a8e6e1c4-6c1d-3a4e-8e5f-4b1f2c3d4e5f",
+	})
+
+	return logs
+}
+
+func TestHandleExportMetricsAllServices_ShouldExportMetricsSortedByService(t *testing.T) {
+	assert := as.New(t)
+
+	filesystem := mock.FileSystemMock{}
+
+	repo := newMemoryRepository(t, getAllServicesLogs()...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportMetricsAllServicesHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{""}
+
+	file := mock.FileMock{}
+	filesystem.On("Create", m.MatchedBy(func(path string) bool {
+		return strings.Contains(path, "all-services")
+	})).Return(&file, nil).Once()
+	file.On("Commit", m.MatchedBy(func(data string) bool {
+		lines := strings.Split(strings.TrimSpace(data), "\n")
+
+		return len(lines) == 3 &&
+			strings.HasPrefix(lines[0], "service;service_name;requests;request_avg;") &&
+			strings.HasPrefix(lines[1], "a8e6e1c4-6c1d-3a4e-8e5f-4b1f2c3d4e5f;payments;1;10.00;") &&
+			strings.HasPrefix(lines[2], "c3e86413-648a-3552-90c3-b13491ee07d6;orders;3;2.00;")
+	})).Return(nil).Once()
+
+	err := h.HandleExportMetricsAllServices(context.Background())
+
+	assert.Nil(err)
+	filesystem.AssertExpectations(t)
+	file.AssertExpectations(t)
+}
+
+func TestHandleExportMetricsAllServices_ShouldSortByColumnDescending(t *testing.T) {
+	assert := as.New(t)
+
+	// The logs are moved into the time range, and one more is left out of it.
+	logs := getAllServicesLogs()
+
+	for _, l := range logs {
+		l.StartedAt += 1566655200000
+	}
+
+	logs = append(logs, &apigateway.Log{
+		Service:   apigateway.Service{Name: "payments"},
+		StartedAt: 1566662400001,
+		ServiceID: "a8e6e1c4-6c1d-3a4e-8e5f-4b1f2c3d4e5f",
+	})
+
+	filesystem := mock.FileSystemMock{}
+
+	repo := newMemoryRepository(t, logs...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportMetricsAllServicesHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--sort", "requests", "--desc", "--from", "1566655200000", "--to", "1566662400000"}
+
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", m.MatchedBy(func(data string) bool {
+		lines := strings.Split(strings.TrimSpace(data), "\n")
+
+		return len(lines) == 3 &&
+			strings.HasPrefix(lines[1], "c3e86413-648a-3552-90c3-b13491ee07d6;orders;3;") &&
+			strings.HasPrefix(lines[2], "a8e6e1c4-6c1d-3a4e-8e5f-4b1f2c3d4e5f;payments;1;")
+	})).Return(nil).Once()
+
+	err := h.HandleExportMetricsAllServices(context.Background())
+
+	assert.Nil(err)
+	filesystem.AssertExpectations(t)
+	file.AssertExpectations(t)
+}
+
+func TestHandleExportMetricsAllServices_ShouldReturnErrorWithUnknownSortColumn(t *testing.T) {
+	assert := as.New(t)
+
+	filesystem := mock.FileSystemMock{}
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportMetricsAllServicesHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--sort", "unknown"}
+
+	err := h.HandleExportMetricsAllServices(context.Background())
+
+	assert.True(errors.Is(err, service.ErrUnknownSortColumn))
+}
+
+func TestHandleExportMetricsAllServices_ShouldReturnErrorOnGettingLogs(t *testing.T) {
+	assert := as.New(t)
+
+	itemsPerPage := 1000
+
+	filesystem := mock.FileSystemMock{}
+
+	driverErr := errors.New("error on getting logs")
+	driverMock := mock.DriverMock{}
+	driverMock.On("Query", driver.Query{Limit: itemsPerPage}, "").Return(driver.Page{}, driverErr).Once()
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportMetricsAllServicesHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{""}
+
+	err := h.HandleExportMetricsAllServices(context.Background())
+
+	assert.Same(driverErr, err)
+}
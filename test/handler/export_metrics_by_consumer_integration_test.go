@@ -0,0 +1,180 @@
+// +build integration
+
+package test
+
+import (
+	"api-gateway-log-parser/application/handler"
+	"api-gateway-log-parser/application/service"
+	"api-gateway-log-parser/pkg/apigateway"
+	"api-gateway-log-parser/pkg/apigateway/repository"
+	"api-gateway-log-parser/pkg/apigateway/repository/driver"
+	mock "api-gateway-log-parser/test/mocks"
+	"context"
+	"errors"
+	as "github.com/stretchr/testify/assert"
+	m "github.com/stretchr/testify/mock"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHandleExportMetricsByConsumer_ShouldReturnErrorWithWrongParameters(t *testing.T) {
+	assert := as.New(t)
+
+	filesystem := mock.FileSystemMock{}
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportMetricsByConsumerHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{}
+
+	err := h.HandleExportMetricsByConsumer(context.Background())
+
+	assert.Same(handler.ErrConsumerParameterNotFound, err)
+
+	os.Args = []string{"", ""}
+
+	err = h.HandleExportMetricsByConsumer(context.Background())
+
+	assert.Same(handler.ErrConsumerParameterCouldNotBeEmpty, err)
+}
+
+func TestHandleExportMetricsByConsumer_ShouldExportUsageByService(t *testing.T) {
+	assert := as.New(t)
+
+	consumerID := "29a5a16b-e4fa-331f-9f1c-5adea563d7de"
+	ordersID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+	paymentsID := "a8e6e1c4-6c1d-3a4e-8e5f-4b1f2c3d4e5f"
+
+	logs := []*apigateway.Log{
+		{
+			Request:    apigateway.Request{Size: 100},
+			Response:   apigateway.Response{Size: 1000},
+			Latencies:  apigateway.Latencies{Proxy: 1, Gateway: 1, Request: 10},
+			StartedAt:  1566660387000,
+			ServiceID:  ordersID,
+			ConsumerID: consumerID,
+		},
+		{
+			Request:    apigateway.Request{Size: 200},
+			Response:   apigateway.Response{Size: 3000},
+			Latencies:  apigateway.Latencies{Proxy: 3, Gateway: 3, Request: 30},
+			StartedAt:  1566660387001,
+			ServiceID:  ordersID,
+			ConsumerID: consumerID,
+		},
+		{
+			Request:    apigateway.Request{Size: 50},
+			Response:   apigateway.Response{Size: 500},
+			Latencies:  apigateway.Latencies{Proxy: 2, Gateway: 2, Request: 20},
+			StartedAt:  1566660387002,
+			ServiceID:  paymentsID,
+			ConsumerID: consumerID,
+		},
+		// Out of the time range.
+		{
+			Request:    apigateway.Request{Size: 400},
+			StartedAt:  1566662400001,
+			ServiceID:  ordersID,
+			ConsumerID: consumerID,
+		},
+	}
+
+	filesystem := mock.FileSystemMock{}
+
+	repo := newMemoryRepository(t, logs...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportMetricsByConsumerHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--from", "1566655200000", "--to", "1566662400000", consumerID}
+
+	file := mock.FileMock{}
+	filesystem.On("Create", m.MatchedBy(func(path string) bool {
+		return strings.Contains(path, consumerID)
+	})).Return(&file, nil).Once()
+	file.On("Commit", m.MatchedBy(func(data string) bool {
+		lines := strings.Split(strings.TrimSpace(data), "\n")
+
+		return len(lines) == 4 &&
+			strings.HasPrefix(lines[0], "consumer;service;requests;bytes_sent;bytes_received;request_avg;proxy_avg;gateway_avg;") &&
+			strings.HasPrefix(lines[1], consumerID+";"+paymentsID+";1;50;500;20.00;2.00;2.00;") &&
+			strings.HasPrefix(lines[2], consumerID+";"+ordersID+";2;300;4000;20.00;2.00;2.00;") &&
+			strings.HasPrefix(lines[3], consumerID+";total;3;350;4500;20.00;2.00;2.00;10;30;")
+	})).Return(nil).Once()
+
+	err := h.HandleExportMetricsByConsumer(context.Background())
+
+	assert.Nil(err)
+	filesystem.AssertExpectations(t)
+	file.AssertExpectations(t)
+}
+
+func TestHandleExportMetricsByConsumer_ShouldReturnErrorOnGettingLogs(t *testing.T) {
+	assert := as.New(t)
+
+	consumerID := "29a5a16b-e4fa-331f-9f1c-5adea563d7de"
+
+	itemsPerPage := 1000
+
+	filesystem := mock.FileSystemMock{}
+
+	driverErr := errors.New("error on getting logs")
+	driverMock := mock.DriverMock{}
+	driverMock.On("Query", driver.Query{ConsumerID: consumerID, Limit: itemsPerPage}, "").Return(driver.Page{}, driverErr).Once()
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportMetricsByConsumerHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", consumerID}
+
+	err := h.HandleExportMetricsByConsumer(context.Background())
+
+	assert.Same(driverErr, err)
+}
+
+func TestHandleExportMetricsByConsumer_ShouldReturnErrorOnWritingMetrics(t *testing.T) {
+	assert := as.New(t)
+
+	consumerID := "29a5a16b-e4fa-331f-9f1c-5adea563d7de"
+
+	filesystemErr := errors.New("error on writing metrics")
+	filesystem := mock.FileSystemMock{}
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", m.Anything).Return(filesystemErr).Once()
+
+	var logs []*apigateway.Log
+
+	repo := newMemoryRepository(t, logs...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportMetricsByConsumerHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", consumerID}
+
+	err := h.HandleExportMetricsByConsumer(context.Background())
+
+	assert.Same(filesystemErr, err)
+}
@@ -7,6 +7,7 @@ import (
 	"api-gateway-log-parser/application/service"
 	"api-gateway-log-parser/pkg/apigateway"
 	"api-gateway-log-parser/pkg/apigateway/repository"
+	"api-gateway-log-parser/pkg/apigateway/repository/driver"
 	mock "api-gateway-log-parser/test/mocks"
 	"bytes"
 	"context"
@@ -16,6 +17,8 @@ import (
 	as "github.com/stretchr/testify/assert"
 	m "github.com/stretchr/testify/mock"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -29,7 +32,7 @@ func TestHandleExportMetricsByService_ShouldReturnErrorWithWrongParameters(t *te
 
 	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
 
-	h := handler.NewExportMetricsByServiceHandler(s)
+	h := handler.NewExportMetricsByServiceHandler(storedService(s))
 
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
@@ -58,8 +61,6 @@ func TestHandleExportMetricsByService_ShouldExportMetrics(t *testing.T) {
 	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
 	userIP := "0.0.0.0"
 
-	itemsPerPage := 1000
-
 	logs = append(logs, &apigateway.Log{
 		Request:             apigateway.Request{},
 		UpstreamURI:         "/",
@@ -97,16 +98,15 @@ func TestHandleExportMetricsByService_ShouldExportMetrics(t *testing.T) {
 	})
 
 	filesystem := mock.FileSystemMock{}
-	filesystem.On("Write", m.Anything, m.Anything).Return(nil).Twice()
-
-	driverMock := mock.DriverMock{}
-	driverMock.On("GetByService", serviceID, itemsPerPage).Return(logs).Twice()
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", m.Anything).Return(nil).Once()
 
-	repo := repository.NewApiGatewayLogRepository(&driverMock)
+	repo := newMemoryRepository(t, logs...)
 
 	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
 
-	h := handler.NewExportMetricsByServiceHandler(s)
+	h := handler.NewExportMetricsByServiceHandler(storedService(s))
 
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
@@ -127,7 +127,6 @@ func TestHandleExportMetricsByService_ShouldExportCorrectMetrics(t *testing.T) {
 	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
 	userIP := "0.0.0.0"
 
-	itemsPerPage := 1000
 	numberOfLogs := 30
 	latenciesValue := 42
 
@@ -148,19 +147,17 @@ func TestHandleExportMetricsByService_ShouldExportCorrectMetrics(t *testing.T) {
 			StartedAt:  12345,
 			ServiceID:  serviceID,
 			ConsumerID: consumerID,
+			ID:         strconv.Itoa(i),
 		})
 	}
 
 	filesystem := mock.FileSystemMock{}
 
-	driverMock := mock.DriverMock{}
-	driverMock.On("GetByService", serviceID, itemsPerPage).Return(logs).Twice()
-
-	repo := repository.NewApiGatewayLogRepository(&driverMock)
+	repo := newMemoryRepository(t, logs...)
 
 	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
 
-	h := handler.NewExportMetricsByServiceHandler(s)
+	h := handler.NewExportMetricsByServiceHandler(storedService(s))
 
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
@@ -171,7 +168,13 @@ func TestHandleExportMetricsByService_ShouldExportCorrectMetrics(t *testing.T) {
 	w := csv.NewWriter(&buffer)
 	defer w.Flush()
 
-	columns := []string{"service", "request_avg", "proxy_avg", "gateway_avg"}
+	columns := []string{
+		"service",
+		"request_avg", "proxy_avg", "gateway_avg",
+		"request_min", "request_max", "request_p50", "request_p90", "request_p95", "request_p99",
+		"proxy_min", "proxy_max", "proxy_p50", "proxy_p90", "proxy_p95", "proxy_p99",
+		"gateway_min", "gateway_max", "gateway_p50", "gateway_p90", "gateway_p95", "gateway_p99",
+	}
 
 	separator := ';'
 	w.Comma = separator
@@ -188,8 +191,14 @@ func TestHandleExportMetricsByService_ShouldExportCorrectMetrics(t *testing.T) {
 		fmt.Sprintf("%.2f", gatewayAvg),
 	}
 
+	for i := 0; i < 3*6; i++ {
+		metrics = append(metrics, strconv.Itoa(latenciesValue))
+	}
+
 	w.WriteAll([][]string{metrics})
-	filesystem.On("Write", m.Anything, buffer.String()).Return(nil).Once()
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", buffer.String()).Return(nil).Once()
 
 	err := h.HandleExportMetricsByService(context.Background())
 
@@ -204,17 +213,18 @@ func TestHandleExportMetricsByService_ShouldReturnErrorOnGettingLogs(t *testing.
 	itemsPerPage := 1000
 
 	filesystem := mock.FileSystemMock{}
-	filesystem.On("Write", m.Anything, m.Anything).Return(nil).Twice()
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
 
 	driverErr := errors.New("error on getting logs")
 	driverMock := mock.DriverMock{}
-	driverMock.On("GetByService", serviceID, itemsPerPage).Return(nil, driverErr).Twice()
+	driverMock.On("Query", driver.Query{ServiceID: serviceID, Limit: itemsPerPage}, "").Return(driver.Page{}, driverErr).Once()
 
 	repo := repository.NewApiGatewayLogRepository(&driverMock)
 
 	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
 
-	h := handler.NewExportMetricsByServiceHandler(s)
+	h := handler.NewExportMetricsByServiceHandler(storedService(s))
 
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
@@ -233,20 +243,17 @@ func TestHandleExportMetricsByService_ShouldReturnErrorOnWritingLogs(t *testing.
 	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
 	var logs []*apigateway.Log
 
-	itemsPerPage := 1000
-
 	filesystemErr := errors.New("error on writing logs")
 	filesystem := mock.FileSystemMock{}
-	filesystem.On("Write", m.Anything, m.Anything).Return(filesystemErr).Twice()
-
-	driverMock := mock.DriverMock{}
-	driverMock.On("GetByService", serviceID, itemsPerPage).Return(logs, nil).Twice()
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", m.Anything).Return(filesystemErr).Once()
 
-	repo := repository.NewApiGatewayLogRepository(&driverMock)
+	repo := newMemoryRepository(t, logs...)
 
 	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
 
-	h := handler.NewExportMetricsByServiceHandler(s)
+	h := handler.NewExportMetricsByServiceHandler(storedService(s))
 
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
@@ -258,3 +265,140 @@ func TestHandleExportMetricsByService_ShouldReturnErrorOnWritingLogs(t *testing.
 	assert.NotNil(err)
 	assert.Same(filesystemErr, err)
 }
+
+func TestHandleExportMetricsByService_ShouldExportPercentiles(t *testing.T) {
+	assert := as.New(t)
+
+	var logs []*apigateway.Log
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	for i := 1; i <= 100; i++ {
+		logs = append(logs, &apigateway.Log{
+			Latencies: apigateway.Latencies{
+				Proxy:   i,
+				Gateway: 1,
+				Request: i * 10,
+			},
+			StartedAt: int64(12345 + i),
+			ServiceID: serviceID,
+		})
+	}
+
+	filesystem := mock.FileSystemMock{}
+
+	repo := newMemoryRepository(t, logs...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportMetricsByServiceHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", serviceID}
+
+	// Above 128ms the percentiles are approximated to within 1%.
+	expected := serviceID + ";505.00;50.50;1.00;" +
+		"10;1000;502;900;948;988;" +
+		"1;100;50;90;95;99;" +
+		"1;1;1;1;1;1\n"
+
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", m.MatchedBy(func(data string) bool {
+		return strings.HasSuffix(data, expected)
+	})).Return(nil).Once()
+
+	err := h.HandleExportMetricsByService(context.Background())
+
+	assert.Nil(err)
+	filesystem.AssertExpectations(t)
+	file.AssertExpectations(t)
+}
+
+func TestHandleExportMetricsByService_ShouldExportWithDelimiterAndTimeRange(t *testing.T) {
+	assert := as.New(t)
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	logs := []*apigateway.Log{
+		{
+			Latencies: apigateway.Latencies{Proxy: 1, Gateway: 2, Request: 3},
+			StartedAt: 1566660387000,
+			ServiceID: serviceID,
+		},
+		// Out of the time range.
+		{
+			Latencies: apigateway.Latencies{Proxy: 100, Gateway: 100, Request: 100},
+			StartedAt: 1566655199999,
+			ServiceID: serviceID,
+		},
+	}
+
+	filesystem := mock.FileSystemMock{}
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", m.MatchedBy(func(data string) bool {
+		return strings.HasPrefix(data, "service\trequest_avg\t") &&
+			strings.Contains(data, serviceID+"\t3.00\t1.00\t2.00\t")
+	})).Return(nil).Once()
+
+	repo := newMemoryRepository(t, logs...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportMetricsByServiceHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--delimiter", `\t`, "--from", "1566655200000", serviceID}
+
+	err := h.HandleExportMetricsByService(context.Background())
+
+	assert.Nil(err)
+	filesystem.AssertExpectations(t)
+	file.AssertExpectations(t)
+}
+
+func TestHandleExportMetricsByService_ShouldExportMetricsAggregatedByTheDriver(t *testing.T) {
+	assert := as.New(t)
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	// The logs are not read, only their summary.
+	driverMock := mock.AggregatorDriverMock{}
+	driverMock.On("SummarizeLatencies", driver.Query{ServiceID: serviceID}, []float64{0.5, 0.9, 0.95, 0.99}).Return(driver.LatencySummary{
+		Count:   100,
+		Request: driver.LatencyStats{Avg: 505, Min: 10, Max: 1000, Quantiles: []int64{500, 900, 950, 990}},
+		Proxy:   driver.LatencyStats{Avg: 50.5, Min: 1, Max: 100, Quantiles: []int64{50, 90, 95, 99}},
+		Gateway: driver.LatencyStats{Avg: 1, Min: 1, Max: 1, Quantiles: []int64{1, 1, 1, 1}},
+	}, nil).Once()
+
+	filesystem := mock.FileSystemMock{}
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", m.MatchedBy(func(data string) bool {
+		return strings.HasSuffix(data, serviceID+";505.00;50.50;1.00;"+
+			"10;1000;500;900;950;990;"+
+			"1;100;50;90;95;99;"+
+			"1;1;1;1;1;1\n")
+	})).Return(nil).Once()
+
+	s, _ := service.NewApiGatewayLogParserService(repository.NewApiGatewayLogRepository(&driverMock), &filesystem)
+
+	h := handler.NewExportMetricsByServiceHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", serviceID}
+
+	err := h.HandleExportMetricsByService(context.Background())
+
+	assert.Nil(err)
+	driverMock.AssertExpectations(t)
+	driverMock.AssertNotCalled(t, "Query", m.Anything, m.Anything)
+	file.AssertExpectations(t)
+}
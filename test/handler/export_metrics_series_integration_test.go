@@ -0,0 +1,274 @@
+// +build integration
+
+package test
+
+import (
+	"api-gateway-log-parser/application/handler"
+	"api-gateway-log-parser/application/service"
+	"api-gateway-log-parser/pkg/apigateway"
+	"api-gateway-log-parser/pkg/apigateway/repository"
+	"api-gateway-log-parser/pkg/apigateway/repository/driver"
+	"api-gateway-log-parser/pkg/exporter"
+	mock "api-gateway-log-parser/test/mocks"
+	"context"
+	"encoding/json"
+	"errors"
+	as "github.com/stretchr/testify/assert"
+	m "github.com/stretchr/testify/mock"
+	"os"
+	"strings"
+	"testing"
+)
+
+func getSeriesLogs(serviceID string) []*apigateway.Log {
+	// 2019-08-24T14:00:00Z, two logs on the first minute, none on the second
+	// and one on the third.
+	start := int64(1566655200000)
+
+	return []*apigateway.Log{
+		{
+			Response:  apigateway.Response{Status: 200},
+			Latencies: apigateway.Latencies{Proxy: 1, Gateway: 1, Request: 10},
+			StartedAt: start + 1000,
+			ServiceID: serviceID,
+		},
+		{
+			Response:  apigateway.Response{Status: 502},
+			Latencies: apigateway.Latencies{Proxy: 3, Gateway: 3, Request: 30},
+			StartedAt: start + 59999,
+			ServiceID: serviceID,
+		},
+		{
+			Response:  apigateway.Response{Status: 404},
+			Latencies: apigateway.Latencies{Proxy: 5, Gateway: 5, Request: 50},
+			StartedAt: start + 120000,
+			ServiceID: serviceID,
+		},
+	}
+}
+
+func TestHandleExportMetricsSeries_ShouldReturnErrorWithWrongParameters(t *testing.T) {
+	assert := as.New(t)
+
+	filesystem := mock.FileSystemMock{}
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportMetricsSeriesHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{}
+
+	err := h.HandleExportMetricsSeries(context.Background())
+
+	assert.Same(handler.ErrServiceParameterNotFound, err)
+
+	os.Args = []string{"", "--bucket", "1h"}
+
+	err = h.HandleExportMetricsSeries(context.Background())
+
+	assert.Same(handler.ErrServiceParameterCouldNotBeEmpty, err)
+
+	os.Args = []string{"", "--bucket", "0s", "c3e86413-648a-3552-90c3-b13491ee07d6"}
+
+	err = h.HandleExportMetricsSeries(context.Background())
+
+	assert.Same(service.ErrInvalidBucket, err)
+
+	os.Args = []string{"", "--format", "xml", "c3e86413-648a-3552-90c3-b13491ee07d6"}
+
+	err = h.HandleExportMetricsSeries(context.Background())
+
+	assert.Same(exporter.ErrUnknownFormat, err)
+}
+
+func TestHandleExportMetricsSeries_ShouldExportBucketsAsCSV(t *testing.T) {
+	assert := as.New(t)
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	filesystem := mock.FileSystemMock{}
+
+	repo := newMemoryRepository(t, getSeriesLogs(serviceID)...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportMetricsSeriesHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", serviceID}
+
+	file := mock.FileMock{}
+	filesystem.On("Create", m.MatchedBy(func(path string) bool {
+		return strings.HasSuffix(path, ".csv")
+	})).Return(&file, nil).Once()
+	file.On("Commit", m.MatchedBy(func(data string) bool {
+		lines := strings.Split(strings.TrimSpace(data), "\n")
+
+		return len(lines) == 4 &&
+			strings.HasPrefix(lines[0], "bucket;requests;errors;request_avg;") &&
+			strings.HasPrefix(lines[1], "2019-08-24T14:00:00Z;2;1;20.00;") &&
+			strings.HasPrefix(lines[2], "2019-08-24T14:01:00Z;0;0;0.00;") &&
+			strings.HasPrefix(lines[3], "2019-08-24T14:02:00Z;1;0;50.00;")
+	})).Return(nil).Once()
+
+	err := h.HandleExportMetricsSeries(context.Background())
+
+	assert.Nil(err)
+	filesystem.AssertExpectations(t)
+	file.AssertExpectations(t)
+}
+
+func TestHandleExportMetricsSeries_ShouldLabelBucketsWithMilliseconds(t *testing.T) {
+	assert := as.New(t)
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	logs := []*apigateway.Log{
+		{StartedAt: 1566660387000, ServiceID: serviceID},
+		{StartedAt: 1566660387150, ServiceID: serviceID},
+	}
+
+	filesystem := mock.FileSystemMock{}
+
+	repo := newMemoryRepository(t, logs...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportMetricsSeriesHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--bucket", "100ms", serviceID}
+
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", m.MatchedBy(func(data string) bool {
+		lines := strings.Split(strings.TrimSpace(data), "\n")
+
+		return len(lines) == 3 &&
+			strings.HasPrefix(lines[1], "2019-08-24T15:26:27.000Z;1;") &&
+			strings.HasPrefix(lines[2], "2019-08-24T15:26:27.100Z;1;")
+	})).Return(nil).Once()
+
+	err := h.HandleExportMetricsSeries(context.Background())
+
+	assert.Nil(err)
+	file.AssertExpectations(t)
+}
+
+func TestHandleExportMetricsSeries_ShouldReturnErrorWithTooManyBuckets(t *testing.T) {
+	assert := as.New(t)
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	logs := []*apigateway.Log{
+		{StartedAt: 1566604800000, ServiceID: serviceID},
+		{StartedAt: 1566691200000, ServiceID: serviceID},
+	}
+
+	filesystem := mock.FileSystemMock{}
+
+	repo := newMemoryRepository(t, logs...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportMetricsSeriesHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	// A day of 1ms buckets is rejected before reading the logs.
+	os.Args = []string{"", "--bucket", "1ms", "--from", "2019-08-24T00:00:00Z", "--to", "2019-08-25T00:00:00Z", serviceID}
+
+	err := h.HandleExportMetricsSeries(context.Background())
+
+	assert.Same(service.ErrTooManyBuckets, err)
+
+	// Without a time range, once the logs are read.
+	os.Args = []string{"", "--bucket", "1ms", serviceID}
+
+	err = h.HandleExportMetricsSeries(context.Background())
+
+	assert.Same(service.ErrTooManyBuckets, err)
+	filesystem.AssertNotCalled(t, "Create", m.Anything)
+}
+
+func TestHandleExportMetricsSeries_ShouldExportBucketsAsJSON(t *testing.T) {
+	assert := as.New(t)
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	// A log before the time range would add a bucket.
+	logs := append(getSeriesLogs(serviceID), &apigateway.Log{StartedAt: 1566655199999, ServiceID: serviceID})
+
+	filesystem := mock.FileSystemMock{}
+
+	repo := newMemoryRepository(t, logs...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportMetricsSeriesHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--bucket", "1h", "--format", "json", "--from", "2019-08-24T14:00:00Z", serviceID}
+
+	var series []map[string]interface{}
+
+	file := mock.FileMock{}
+	filesystem.On("Create", m.MatchedBy(func(path string) bool {
+		return strings.HasSuffix(path, ".json")
+	})).Return(&file, nil).Once()
+	file.On("Commit", m.MatchedBy(func(data string) bool {
+		return json.Unmarshal([]byte(data), &series) == nil
+	})).Return(nil).Once()
+
+	err := h.HandleExportMetricsSeries(context.Background())
+
+	assert.Nil(err)
+	assert.Len(series, 1)
+	assert.Equal("2019-08-24T14:00:00Z", series[0]["bucket"])
+	assert.EqualValues(3, series[0]["requests"])
+	assert.EqualValues(1, series[0]["errors"])
+	assert.EqualValues(30, series[0]["request_avg"])
+	assert.EqualValues(50, series[0]["request_max"])
+}
+
+func TestHandleExportMetricsSeries_ShouldReturnErrorOnGettingLogs(t *testing.T) {
+	assert := as.New(t)
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	itemsPerPage := 1000
+
+	filesystem := mock.FileSystemMock{}
+
+	driverErr := errors.New("error on getting logs")
+	driverMock := mock.DriverMock{}
+	driverMock.On("Query", driver.Query{ServiceID: serviceID, Limit: itemsPerPage}, "").Return(driver.Page{}, driverErr).Once()
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportMetricsSeriesHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", serviceID}
+
+	err := h.HandleExportMetricsSeries(context.Background())
+
+	assert.Same(driverErr, err)
+}
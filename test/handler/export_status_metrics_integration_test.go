@@ -0,0 +1,178 @@
+// +build integration
+
+package test
+
+import (
+	"api-gateway-log-parser/application/handler"
+	"api-gateway-log-parser/application/service"
+	"api-gateway-log-parser/pkg/apigateway"
+	"api-gateway-log-parser/pkg/apigateway/repository"
+	"api-gateway-log-parser/pkg/apigateway/repository/driver"
+	mock "api-gateway-log-parser/test/mocks"
+	"context"
+	"errors"
+	as "github.com/stretchr/testify/assert"
+	m "github.com/stretchr/testify/mock"
+	"os"
+	"testing"
+)
+
+func getStatusLogs() []*apigateway.Log {
+	var logs []*apigateway.Log
+
+	statuses := map[string][]int{
+		"29a5a16b-e4fa-331f-9f1c-5adea563d7de": {200, 200, 404, 500},
+		"7d2e7e62-0d1f-3c8a-9a1b-2f4e6a8b0c1d": {200, 301},
+	}
+
+	for consumerID, codes := range statuses {
+		for _, code := range codes {
+			logs = append(logs, &apigateway.Log{
+				Response:   apigateway.Response{Status: code},
+				StartedAt:  int64(12345 + len(logs)),
+				ServiceID:  "c3e86413-648a-3552-90c3-b13491ee07d6",
+				ConsumerID: consumerID,
+			})
+		}
+	}
+
+	return logs
+}
+
+func TestHandleExportStatusMetrics_ShouldReturnErrorWithWrongParameters(t *testing.T) {
+	assert := as.New(t)
+
+	filesystem := mock.FileSystemMock{}
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportStatusMetricsHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{}
+
+	err := h.HandleExportStatusMetrics(context.Background())
+
+	assert.Same(handler.ErrGroupParameterNotFound, err)
+
+	os.Args = []string{"", "service"}
+
+	err = h.HandleExportStatusMetrics(context.Background())
+
+	assert.Same(handler.ErrIDParameterCouldNotBeEmpty, err)
+
+	os.Args = []string{"", "route", "c3e86413-648a-3552-90c3-b13491ee07d6"}
+
+	err = h.HandleExportStatusMetrics(context.Background())
+
+	assert.Same(service.ErrUnknownGroup, err)
+}
+
+func TestHandleExportStatusMetrics_ShouldExportStatusByConsumerOfService(t *testing.T) {
+	assert := as.New(t)
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	filesystem := mock.FileSystemMock{}
+
+	repo := newMemoryRepository(t, getStatusLogs()...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportStatusMetricsHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "service", serviceID}
+
+	expected := "consumer;requests;2xx;3xx;4xx;5xx;client_error_rate;server_error_rate;status_200;status_301;status_404;status_500\n" +
+		"29a5a16b-e4fa-331f-9f1c-5adea563d7de;4;2;0;1;1;25.00;25.00;2;0;1;1\n" +
+		"7d2e7e62-0d1f-3c8a-9a1b-2f4e6a8b0c1d;2;1;1;0;0;0.00;0.00;1;1;0;0\n" +
+		"total;6;3;1;1;1;16.67;16.67;3;1;1;1\n"
+
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", expected).Return(nil).Once()
+
+	err := h.HandleExportStatusMetrics(context.Background())
+
+	assert.Nil(err)
+	filesystem.AssertExpectations(t)
+	file.AssertExpectations(t)
+}
+
+func TestHandleExportStatusMetrics_ShouldExportStatusByServiceOfConsumer(t *testing.T) {
+	assert := as.New(t)
+
+	consumerID := "29a5a16b-e4fa-331f-9f1c-5adea563d7de"
+
+	logs := []*apigateway.Log{
+		{Response: apigateway.Response{Status: 503}, StartedAt: 1566660387000, ServiceID: "c3e86413-648a-3552-90c3-b13491ee07d6", ConsumerID: consumerID},
+		{Response: apigateway.Response{Status: 200}, StartedAt: 1566660387000, ServiceID: "a8e6e1c4-6c1d-3a4e-8e5f-4b1f2c3d4e5f", ConsumerID: consumerID},
+		// Out of the time range.
+		{Response: apigateway.Response{Status: 500}, StartedAt: 1566655199999, ServiceID: "a8e6e1c4-6c1d-3a4e-8e5f-4b1f2c3d4e5f", ConsumerID: consumerID},
+	}
+
+	filesystem := mock.FileSystemMock{}
+
+	repo := newMemoryRepository(t, logs...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportStatusMetricsHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--from", "1566655200000", "consumer", consumerID}
+
+	expected := "service;requests;2xx;3xx;4xx;5xx;client_error_rate;server_error_rate;status_200;status_503\n" +
+		"a8e6e1c4-6c1d-3a4e-8e5f-4b1f2c3d4e5f;1;1;0;0;0;0.00;0.00;1;0\n" +
+		"c3e86413-648a-3552-90c3-b13491ee07d6;1;0;0;0;1;0.00;100.00;0;1\n" +
+		"total;2;1;0;0;1;0.00;50.00;1;1\n"
+
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", expected).Return(nil).Once()
+
+	err := h.HandleExportStatusMetrics(context.Background())
+
+	assert.Nil(err)
+	filesystem.AssertExpectations(t)
+	file.AssertExpectations(t)
+}
+
+func TestHandleExportStatusMetrics_ShouldReturnErrorOnGettingLogs(t *testing.T) {
+	assert := as.New(t)
+
+	serviceID := "c3e86413-648a-3552-90c3-b13491ee07d6"
+
+	itemsPerPage := 1000
+
+	filesystem := mock.FileSystemMock{}
+
+	driverErr := errors.New("error on getting logs")
+	driverMock := mock.DriverMock{}
+	driverMock.On("Query", driver.Query{ServiceID: serviceID, Limit: itemsPerPage}, "").Return(driver.Page{}, driverErr).Once()
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewExportStatusMetricsHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "service", serviceID}
+
+	err := h.HandleExportStatusMetrics(context.Background())
+
+	assert.Same(driverErr, err)
+}
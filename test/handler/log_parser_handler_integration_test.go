@@ -5,14 +5,24 @@ package test
 import (
 	"api-gateway-log-parser/application/handler"
 	"api-gateway-log-parser/application/service"
+	"api-gateway-log-parser/pkg/apigateway"
 	"api-gateway-log-parser/pkg/apigateway/repository"
+	"api-gateway-log-parser/pkg/filesystem"
 	mock "api-gateway-log-parser/test/mocks"
-	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
 	as "github.com/stretchr/testify/assert"
 	m "github.com/stretchr/testify/mock"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -49,7 +59,7 @@ func TestHandleLogParser_ShouldReturnErrorWithWrongParameters(t *testing.T) {
 func TestHandleLogParser_ShouldParseLogs(t *testing.T) {
 	assert := as.New(t)
 
-	buffer := bytes.NewBufferString(getLog())
+	file := ioutil.NopCloser(bytes.NewBufferString(getLogLine() + "\n" + getLogLine()))
 
 	filesystem := mock.FileSystemMock{}
 	driverMock := mock.DriverMock{}
@@ -62,24 +72,592 @@ func TestHandleLogParser_ShouldParseLogs(t *testing.T) {
 
 	path := "logs.txt"
 
-	file := os.File{}
-	scanner := bufio.NewScanner(buffer)
+	filesystem.On("Resolve", path).Return([]string{path}, nil).Once()
+	filesystem.On("Fingerprint", path).Return("fingerprint", nil).Once()
+	filesystem.On("Open", path).Return(file).Once()
 
-	filesystem.On("Open", path).Return(&file).Once()
-	filesystem.On("GetScanner", &file).Return(scanner).Once()
-	filesystem.On("GetLine", scanner).Return(getLog()).Twice()
+	driverMock.On("AddBatch", m.MatchedBy(func(logs []*apigateway.Log) bool { return len(logs) == 2 })).Return(2, nil).Once()
+	filesystem.On("Replace", path+".checkpoint", m.Anything).Return(nil).Twice()
 
-	driverMock.On("AddBatch", m.Anything).Return(nil).Once()
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", path}
+
+	err := h.HandleApiGatewayLogParser(context.Background())
+
+	assert.Nil(err)
+	driverMock.AssertExpectations(t)
+	filesystem.AssertExpectations(t)
+}
+
+func TestHandleLogParser_ShouldIdentifyLogsByRecord(t *testing.T) {
+	assert := as.New(t)
+
+	// Same service and millisecond, another client, then the first record again.
+	other := strings.Replace(getLogLine(), `"client_ip": "`, `"client_ip": "1`, 1)
+	file := ioutil.NopCloser(bytes.NewBufferString(getLogLine() + "\n" + other + "\n" + getLogLine()))
+
+	filesystem := mock.FileSystemMock{}
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewLogParserHandler(s)
+
+	path := "logs.txt"
+
+	filesystem.On("Resolve", path).Return([]string{path}, nil).Once()
+	filesystem.On("Fingerprint", path).Return("fingerprint", nil).Once()
+	filesystem.On("Open", path).Return(file).Once()
+	filesystem.On("Replace", path+".checkpoint", m.Anything).Return(nil).Twice()
+
+	driverMock.On("AddBatch", m.MatchedBy(func(logs []*apigateway.Log) bool {
+		return len(logs) == 3 &&
+			logs[0].StartedAt == logs[1].StartedAt &&
+			logs[0].ID != "" && logs[0].ID != logs[1].ID && logs[0].ID == logs[2].ID
+	})).Return(2, nil).Once()
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", path}
+
+	err := h.HandleApiGatewayLogParser(context.Background())
+
+	assert.Nil(err)
+	driverMock.AssertExpectations(t)
+}
+
+func TestHandleLogParser_ShouldReturnErrorOnAddingLogs(t *testing.T) {
+	assert := as.New(t)
+
+	file := ioutil.NopCloser(bytes.NewBufferString(getLogLine()))
+
+	filesystem := mock.FileSystemMock{}
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem, service.WithWorkers(2))
+
+	h := handler.NewLogParserHandler(s)
+
+	path := "logs.txt"
+
+	filesystem.On("Resolve", path).Return([]string{path}, nil).Once()
+	filesystem.On("Fingerprint", path).Return("fingerprint", nil).Once()
+	filesystem.On("Open", path).Return(file).Once()
+
+	driverErr := errors.New("error on adding logs")
+	driverMock.On("AddBatch", m.Anything).Return(0, driverErr).Once()
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", path}
+
+	err := h.HandleApiGatewayLogParser(context.Background())
+
+	assert.NotNil(err)
+	assert.Same(driverErr, err)
+}
+
+func TestHandleLogParser_ShouldResumeFromCheckpoint(t *testing.T) {
+	assert := as.New(t)
+
+	line := getLogLine()
+	file := ioutil.NopCloser(bytes.NewBufferString(line + "\n" + line + "\n"))
+
+	filesystem := mock.FileSystemMock{}
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewLogParserHandler(s)
+
+	path := "logs.txt"
+	offset := len(line) + 1
+
+	filesystem.On("Resolve", path).Return([]string{path}, nil).Once()
+	filesystem.On("Fingerprint", path).Return("fingerprint", nil).Once()
+	filesystem.On("Read", path+".checkpoint").
+		Return(fmt.Sprintf(`{"path":"%s","fingerprint":"fingerprint","offset":%d,"line":1}`, path, offset), nil).
+		Once()
+	filesystem.On("Open", path).Return(file).Once()
+	filesystem.On("Replace", path+".checkpoint", fmt.Sprintf(`{"path":"%s","fingerprint":"fingerprint","offset":%d,"line":2}`, path, offset*2)).
+		Return(nil).
+		Once()
+	filesystem.On("Replace", path+".checkpoint", fmt.Sprintf(`{"path":"%s","fingerprint":"fingerprint","offset":%d,"line":2,"completed":true}`, path, offset*2)).
+		Return(nil).
+		Once()
+
+	driverMock.On("AddBatch", m.MatchedBy(func(logs []*apigateway.Log) bool { return len(logs) == 1 })).Return(1, nil).Once()
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--resume", path}
+
+	err := h.HandleApiGatewayLogParser(context.Background())
+
+	assert.Nil(err)
+	filesystem.AssertExpectations(t)
+	driverMock.AssertExpectations(t)
+}
+
+func TestHandleLogParser_ShouldParseWithoutCheckpoint(t *testing.T) {
+	assert := as.New(t)
+
+	file := ioutil.NopCloser(bytes.NewBufferString(getLogLine() + "\n"))
+
+	filesystem := mock.FileSystemMock{}
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewLogParserHandler(s)
+
+	path := "/readonly/logs.txt"
+
+	filesystem.On("Resolve", path).Return([]string{path}, nil).Once()
+	filesystem.On("Open", path).Return(file).Once()
+
+	driverMock.On("AddBatch", m.Anything).Return(1, nil).Once()
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--no-checkpoint", path}
+
+	err := h.HandleApiGatewayLogParser(context.Background())
+
+	assert.Nil(err)
+	filesystem.AssertExpectations(t)
+	filesystem.AssertNotCalled(t, "Replace", m.Anything, m.Anything)
+
+	os.Args = []string{"", "--no-checkpoint", "--resume", path}
+
+	err = h.HandleApiGatewayLogParser(context.Background())
+
+	assert.Same(handler.ErrResumeWithoutCheckpoint, err)
+}
+
+func TestHandleLogParser_ShouldParseFromStdin(t *testing.T) {
+	assert := as.New(t)
+
+	stdin, err := ioutil.TempFile("", "stdin")
+	assert.Nil(err)
+	defer os.Remove(stdin.Name())
+
+	_, err = stdin.WriteString(getLogLine() + "\n")
+	assert.Nil(err)
+
+	_, err = stdin.Seek(0, io.SeekStart)
+	assert.Nil(err)
+
+	oldStdin := os.Stdin
+	defer func() { os.Stdin = oldStdin }()
+
+	os.Stdin = stdin
+
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, filesystem.NewLocalFileSystem())
+
+	h := handler.NewLogParserHandler(s)
+
+	driverMock.On("AddBatch", m.MatchedBy(func(logs []*apigateway.Log) bool { return len(logs) == 1 })).Return(1, nil).Once()
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "-"}
+
+	err = h.HandleApiGatewayLogParser(context.Background())
+
+	assert.Nil(err)
+	driverMock.AssertExpectations(t)
+}
+
+func TestHandleLogParser_ShouldReturnErrorOnResumingChangedFile(t *testing.T) {
+	assert := as.New(t)
+
+	filesystem := mock.FileSystemMock{}
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewLogParserHandler(s)
+
+	path := "logs.txt"
+
+	filesystem.On("Resolve", path).Return([]string{path}, nil).Once()
+	filesystem.On("Fingerprint", path).Return("fingerprint", nil).Once()
+	filesystem.On("Read", path+".checkpoint").
+		Return(`{"path":"logs.txt","fingerprint":"another","offset":10,"line":1}`, nil).
+		Once()
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--resume", path}
+
+	err := h.HandleApiGatewayLogParser(context.Background())
+
+	assert.NotNil(err)
+	assert.Same(service.ErrCheckpointDoesNotMatchFile, err)
+}
+
+func TestHandleLogParser_ShouldRejectMalformedLinesOnLenientMode(t *testing.T) {
+	assert := as.New(t)
+
+	line := getLogLine()
+
+	dir, err := ioutil.TempDir("", "logs")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logs.txt")
+
+	err = ioutil.WriteFile(path, []byte(line+"\n\n"+line[:100]+"\n"+line+"\n"), 0644)
+	assert.Nil(err)
+
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, filesystem.NewLocalFileSystem())
+
+	h := handler.NewLogParserHandler(s)
+
+	driverMock.On("AddBatch", m.MatchedBy(func(logs []*apigateway.Log) bool { return len(logs) == 2 })).Return(2, nil).Once()
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--lenient", path}
+
+	err = h.HandleApiGatewayLogParser(context.Background())
+
+	assert.Nil(err)
+	driverMock.AssertExpectations(t)
+
+	rejected, err := ioutil.ReadFile(path + ".rejected.jsonl")
+	assert.Nil(err)
+	assert.Contains(string(rejected), `{"path":"`+path+`","line":3,"error":"unexpected end of JSON input"`)
+	assert.Equal(1, strings.Count(string(rejected), "\n"))
+
+	// A new parse starts the dead-letter file over, only resuming adds to it.
+	driverMock.On("AddBatch", m.Anything).Return(0, nil).Once()
+
+	err = h.HandleApiGatewayLogParser(context.Background())
+
+	assert.Nil(err)
+
+	rejected, err = ioutil.ReadFile(path + ".rejected.jsonl")
+	assert.Nil(err)
+	assert.Equal(1, strings.Count(string(rejected), "\n"))
+}
+
+func TestHandleLogParser_ShouldShareTheDeadLetterFileAcrossFiles(t *testing.T) {
+	assert := as.New(t)
+
+	line := getLogLine()
+
+	dir, err := ioutil.TempDir("", "logs")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "a.log")
+	second := filepath.Join(dir, "b.log")
+	deadLetter := filepath.Join(dir, "rejected.jsonl")
+
+	assert.Nil(ioutil.WriteFile(first, []byte(line+"\n"+line[:100]+"\n"), 0644))
+	assert.Nil(ioutil.WriteFile(second, []byte(line[:100]+"\n"+line+"\n"), 0644))
+	assert.Nil(ioutil.WriteFile(deadLetter, []byte("{}\n"), 0644))
+
+	driverMock := mock.DriverMock{}
+	driverMock.On("AddBatch", m.Anything).Return(1, nil).Twice()
+
+	s, _ := service.NewApiGatewayLogParserService(repository.NewApiGatewayLogRepository(&driverMock), filesystem.NewLocalFileSystem())
+
+	h := handler.NewLogParserHandler(s)
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--lenient", "--no-checkpoint", "--dead-letter", deadLetter, filepath.Join(dir, "*.log")}
+
+	err = h.HandleApiGatewayLogParser(context.Background())
+
+	assert.Nil(err)
+	driverMock.AssertExpectations(t)
+
+	// The file is started over once, then keeps the lines of every file.
+	rejected, err := ioutil.ReadFile(deadLetter)
+	assert.Nil(err)
+	assert.Equal(2, strings.Count(string(rejected), "\n"))
+	assert.True(strings.HasPrefix(string(rejected), `{"path":"`+first+`","line":2,`))
+	assert.Contains(string(rejected), "\n"+`{"path":"`+second+`","line":1,`)
+}
+
+func TestHandleLogParser_ShouldReturnErrorOnEmptyLine(t *testing.T) {
+	assert := as.New(t)
+
+	line := getLogLine()
+
+	dir, err := ioutil.TempDir("", "logs")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logs.txt")
+
+	err = ioutil.WriteFile(path, []byte(line+"\n\n"+line+"\n"), 0644)
+	assert.Nil(err)
+
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, filesystem.NewLocalFileSystem())
+
+	h := handler.NewLogParserHandler(s)
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", path}
+
+	err = h.HandleApiGatewayLogParser(context.Background())
+
+	assert.True(errors.Is(err, service.ErrEmptyLine))
+	assert.EqualError(err, "line 2: empty line")
+	driverMock.AssertNotCalled(t, "AddBatch", m.Anything)
+}
+
+func TestHandleLogParser_ShouldResumeAfterStoppingHalfway(t *testing.T) {
+	assert := as.New(t)
+
+	line := getLogLine()
+
+	dir, err := ioutil.TempDir("", "logs")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logs.txt")
+
+	// The first batch is written before the parse stops on the empty line.
+	content := strings.Repeat(line+"\n", 202) + "\n" + strings.Repeat(line+"\n", 10)
+
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+	assert.Nil(err)
+
+	driverMock := mock.DriverMock{}
+	driverMock.On("AddBatch", m.MatchedBy(func(logs []*apigateway.Log) bool { return len(logs) == 201 })).Return(201, nil).Once()
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, filesystem.NewLocalFileSystem())
+
+	h := handler.NewLogParserHandler(s)
 
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
 
 	os.Args = []string{"", path}
 
+	err = h.HandleApiGatewayLogParser(context.Background())
+
+	assert.True(errors.Is(err, service.ErrEmptyLine))
+
+	checkpoint, err := ioutil.ReadFile(path + ".checkpoint")
+	assert.Nil(err)
+	assert.Contains(string(checkpoint), `"line":201`)
+	assert.NotContains(string(checkpoint), `"completed"`)
+
+	driverMock.On("AddBatch", m.MatchedBy(func(logs []*apigateway.Log) bool { return len(logs) == 11 })).Return(11, nil).Once()
+
+	os.Args = []string{"", "--resume", "--lenient", path}
+
+	err = h.HandleApiGatewayLogParser(context.Background())
+
+	assert.Nil(err)
+	driverMock.AssertExpectations(t)
+}
+
+func TestHandleLogParser_ShouldParseCompressedFilesFromDirectory(t *testing.T) {
+	assert := as.New(t)
+
+	line := getLogLine()
+
+	dir, err := ioutil.TempDir("", "logs")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	_, err = gw.Write([]byte(line + "\n" + line + "\n"))
+	assert.Nil(err)
+	assert.Nil(gw.Close())
+
+	var zst bytes.Buffer
+	zw, err := zstd.NewWriter(&zst)
+	assert.Nil(err)
+	_, err = zw.Write([]byte(line + "\n"))
+	assert.Nil(err)
+	assert.Nil(zw.Close())
+
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "access.log.1.gz"), gz.Bytes(), 0644))
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "access.log.2.zst"), zst.Bytes(), 0644))
+
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, filesystem.NewLocalFileSystem())
+
+	h := handler.NewLogParserHandler(s)
+
+	driverMock.On("AddBatch", m.MatchedBy(func(logs []*apigateway.Log) bool { return len(logs) == 2 })).Return(2, nil).Once()
+	driverMock.On("AddBatch", m.MatchedBy(func(logs []*apigateway.Log) bool { return len(logs) == 1 })).Return(1, nil).Once()
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", dir}
+
+	err = h.HandleApiGatewayLogParser(context.Background())
+
+	assert.Nil(err)
+	driverMock.AssertExpectations(t)
+
+	os.Args = []string{"", "--resume", filepath.Join(dir, "access.log.*")}
+
+	err = h.HandleApiGatewayLogParser(context.Background())
+
+	assert.Nil(err)
+	driverMock.AssertNumberOfCalls(t, "AddBatch", 2)
+}
+
+func TestHandleLogParser_ShouldParseJsonStream(t *testing.T) {
+	assert := as.New(t)
+
+	file := ioutil.NopCloser(bytes.NewBufferString(getLog() + "\n" + getLog()))
+
+	filesystem := mock.FileSystemMock{}
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewLogParserHandler(s)
+
+	path := "logs.txt"
+
+	filesystem.On("Resolve", path).Return([]string{path}, nil).Once()
+	filesystem.On("Fingerprint", path).Return("fingerprint", nil).Once()
+	filesystem.On("Open", path).Return(file).Once()
+	filesystem.On("Replace", path+".checkpoint", m.Anything).Return(nil).Twice()
+
+	driverMock.On("AddBatch", m.MatchedBy(func(logs []*apigateway.Log) bool { return len(logs) == 2 })).Return(2, nil).Once()
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--stream", path}
+
+	err := h.HandleApiGatewayLogParser(context.Background())
+
+	assert.Nil(err)
+	driverMock.AssertExpectations(t)
+
+	// The values of a stream are counted as records, not lines.
+	file = ioutil.NopCloser(bytes.NewBufferString(getLog() + "\n{\"started_at\": }"))
+
+	filesystem.On("Resolve", path).Return([]string{path}, nil).Once()
+	filesystem.On("Fingerprint", path).Return("fingerprint", nil).Once()
+	filesystem.On("Open", path).Return(file).Once()
+
+	err = h.HandleApiGatewayLogParser(context.Background())
+
+	assert.NotNil(err)
+	assert.True(strings.HasPrefix(err.Error(), "record 2: "))
+
+	// A stream cannot go on after a malformed value, so it is never lenient.
+	os.Args = []string{"", "--stream", "--lenient", path}
+
+	err = h.HandleApiGatewayLogParser(context.Background())
+
+	assert.Same(handler.ErrLenientStream, err)
+}
+
+func TestHandleLogParser_ShouldRejectLinesLongerThanMaxSize(t *testing.T) {
+	assert := as.New(t)
+
+	line := getLogLine()
+	file := ioutil.NopCloser(bytes.NewBufferString(line + "\n" + strings.Repeat(" ", 100) + line + "\n" + line + "\n"))
+
+	filesystem := mock.FileSystemMock{}
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewLogParserHandler(s)
+
+	path := "logs.txt"
+
+	filesystem.On("Resolve", path).Return([]string{path}, nil).Once()
+	filesystem.On("Fingerprint", path).Return("fingerprint", nil).Once()
+	filesystem.On("Open", path).Return(file).Once()
+	rejected := mock.WriterMock{}
+	filesystem.On("OpenWriter", path+".rejected.jsonl", true).Return(&rejected, nil).Once()
+	filesystem.On("Replace", path+".checkpoint", m.Anything).Return(nil).Twice()
+
+	driverMock.On("AddBatch", m.MatchedBy(func(logs []*apigateway.Log) bool { return len(logs) == 2 })).Return(2, nil).Once()
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--lenient", "--max-line-size", strconv.Itoa(len(line) + 10), path}
+
 	err := h.HandleApiGatewayLogParser(context.Background())
 
 	assert.Nil(err)
+	driverMock.AssertExpectations(t)
+	filesystem.AssertExpectations(t)
+	assert.True(strings.HasPrefix(rejected.String(), `{"path":"logs.txt","line":2,"error":"line is longer than the max line size"`))
+	assert.True(rejected.Closed)
+
+	file = ioutil.NopCloser(bytes.NewBufferString(line + "\n" + strings.Repeat(" ", 100) + line + "\n"))
+
+	filesystem.On("Resolve", path).Return([]string{path}, nil).Once()
+	filesystem.On("Fingerprint", path).Return("fingerprint", nil).Once()
+	filesystem.On("Open", path).Return(file).Once()
+
+	os.Args = []string{"", "--max-line-size", strconv.Itoa(len(line) + 10), path}
+
+	err = h.HandleApiGatewayLogParser(context.Background())
+
+	assert.NotNil(err)
+	assert.True(errors.Is(err, service.ErrLineTooLong))
+}
 
+func getLogLine() string {
+	return strings.ReplaceAll(getLog(), "\n", "")
 }
 
 func getLog() string {
@@ -0,0 +1,29 @@
+// +build integration
+
+package test
+
+import (
+	"api-gateway-log-parser/pkg/apigateway"
+	"api-gateway-log-parser/pkg/apigateway/repository"
+	"api-gateway-log-parser/pkg/apigateway/repository/driver"
+	"testing"
+)
+
+// newMemoryRepository stores the logs on memory, where they are queried,
+// ordered and paged like on DynamoDB. Logs with the same key are stored once,
+// so each log of a test needs its own.
+func newMemoryRepository(t *testing.T, logs ...*apigateway.Log) *repository.ApiGatewayLogRepository {
+	d, _ := driver.NewMemoryDriver("apigateway-logs")
+
+	added, err := d.AddBatch(logs...)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if added != len(logs) {
+		t.Fatalf("%d of %d logs stored, the others have the same key", added, len(logs))
+	}
+
+	return repository.NewApiGatewayLogRepository(d)
+}
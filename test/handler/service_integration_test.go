@@ -0,0 +1,16 @@
+// +build integration
+
+package test
+
+import (
+	"api-gateway-log-parser/application/handler"
+	"api-gateway-log-parser/pkg/apigateway"
+)
+
+// storedService is the service of the stored logs the export handlers build
+// when they need it, here an already built one.
+func storedService(s apigateway.LogService) handler.ServiceFunc {
+	return func() (apigateway.LogService, error) {
+		return s, nil
+	}
+}
@@ -0,0 +1,203 @@
+// +build integration
+
+package test
+
+import (
+	"api-gateway-log-parser/application/handler"
+	"api-gateway-log-parser/application/service"
+	"api-gateway-log-parser/pkg/apigateway"
+	"api-gateway-log-parser/pkg/apigateway/repository"
+	"api-gateway-log-parser/pkg/apigateway/repository/driver"
+	mock "api-gateway-log-parser/test/mocks"
+	"context"
+	"errors"
+	as "github.com/stretchr/testify/assert"
+	m "github.com/stretchr/testify/mock"
+	"os"
+	"testing"
+)
+
+func getTopLogs() []*apigateway.Log {
+	var logs []*apigateway.Log
+
+	routes := []struct {
+		id       string
+		path     string
+		requests int
+		latency  int
+		status   int
+	}{
+		{"route-fast", "/orders", 3, 10, 200},
+		{"route-slow", "/payments", 1, 900, 503},
+		{"route-medium", "/users", 2, 100, 200},
+	}
+
+	for _, r := range routes {
+		for i := 0; i < r.requests; i++ {
+			logs = append(logs, &apigateway.Log{
+				Response:  apigateway.Response{Status: r.status, Size: 100},
+				Route:     apigateway.Route{ID: r.id, Paths: []string{r.path}},
+				Latencies: apigateway.Latencies{Request: r.latency},
+				ClientIP:  "0.0.0.0",
+				StartedAt: int64(1566660387000 + len(logs)),
+			})
+		}
+	}
+
+	return logs
+}
+
+func TestHandleTop_ShouldRankRoutesByRequests(t *testing.T) {
+	assert := as.New(t)
+
+	filesystem := mock.FileSystemMock{}
+
+	repo := newMemoryRepository(t, getTopLogs()...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewTopHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{""}
+
+	expected := "route;name;requests;errors;response_bytes;request_p95\n" +
+		"route-fast;/orders;3;0;300;10\n" +
+		"route-medium;/users;2;0;200;100\n" +
+		"route-slow;/payments;1;1;100;900\n"
+
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", expected).Return(nil).Once()
+
+	err := h.HandleTop(context.Background())
+
+	assert.Nil(err)
+	filesystem.AssertExpectations(t)
+	file.AssertExpectations(t)
+}
+
+func TestHandleTop_ShouldRankByMetricWithLimit(t *testing.T) {
+	assert := as.New(t)
+
+	// The slowest route is out of the time range.
+	logs := append(getTopLogs(), &apigateway.Log{
+		Route:     apigateway.Route{ID: "route-old", Paths: []string{"/old"}},
+		Latencies: apigateway.Latencies{Request: 5000},
+		StartedAt: 1566662400001,
+	})
+
+	filesystem := mock.FileSystemMock{}
+
+	repo := newMemoryRepository(t, logs...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewTopHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--metric", "request_p95", "--limit", "2", "--from", "1566655200000", "--to", "1566662400000"}
+
+	expected := "route;name;requests;errors;response_bytes;request_p95\n" +
+		"route-slow;/payments;1;1;100;900\n" +
+		"route-medium;/users;2;0;200;100\n"
+
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", expected).Return(nil).Once()
+
+	err := h.HandleTop(context.Background())
+
+	assert.Nil(err)
+	filesystem.AssertExpectations(t)
+	file.AssertExpectations(t)
+}
+
+func TestHandleTop_ShouldRankClientIPs(t *testing.T) {
+	assert := as.New(t)
+
+	filesystem := mock.FileSystemMock{}
+
+	repo := newMemoryRepository(t, getTopLogs()...)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewTopHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--by", "client_ip", "--metric", "errors"}
+
+	expected := "client_ip;name;requests;errors;response_bytes;request_p95\n" +
+		"0.0.0.0;;6;1;600;900\n"
+
+	file := mock.FileMock{}
+	filesystem.On("Create", m.Anything).Return(&file, nil).Once()
+	file.On("Commit", expected).Return(nil).Once()
+
+	err := h.HandleTop(context.Background())
+
+	assert.Nil(err)
+	filesystem.AssertExpectations(t)
+	file.AssertExpectations(t)
+}
+
+func TestHandleTop_ShouldReturnErrorWithWrongParameters(t *testing.T) {
+	assert := as.New(t)
+
+	filesystem := mock.FileSystemMock{}
+	driverMock := mock.DriverMock{}
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewTopHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"", "--by", "planet"}
+
+	err := h.HandleTop(context.Background())
+
+	assert.Same(service.ErrUnknownEntity, err)
+
+	os.Args = []string{"", "--metric", "happiness"}
+
+	err = h.HandleTop(context.Background())
+
+	assert.Same(service.ErrUnknownMetric, err)
+}
+
+func TestHandleTop_ShouldReturnErrorOnGettingLogs(t *testing.T) {
+	assert := as.New(t)
+
+	itemsPerPage := 1000
+
+	filesystem := mock.FileSystemMock{}
+
+	driverErr := errors.New("error on getting logs")
+	driverMock := mock.DriverMock{}
+	driverMock.On("Query", driver.Query{Limit: itemsPerPage}, "").Return(driver.Page{}, driverErr).Once()
+
+	repo := repository.NewApiGatewayLogRepository(&driverMock)
+
+	s, _ := service.NewApiGatewayLogParserService(repo, &filesystem)
+
+	h := handler.NewTopHandler(storedService(s))
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{""}
+
+	err := h.HandleTop(context.Background())
+
+	assert.Same(driverErr, err)
+}
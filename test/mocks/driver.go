@@ -2,6 +2,7 @@ package mock
 
 import (
 	"api-gateway-log-parser/pkg/apigateway"
+	"api-gateway-log-parser/pkg/apigateway/repository/driver"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -39,40 +40,26 @@ func (d *DriverMock) Add(log *apigateway.Log) error {
 	return nil
 }
 
-func (d *DriverMock) AddBatch(logs ...*apigateway.Log) error {
+func (d *DriverMock) AddBatch(logs ...*apigateway.Log) (int, error) {
 	args := d.Called(logs)
 
-	if args.Get(0) == nil {
-		return args.Error(0)
-	}
-
-	return nil
+	return args.Int(0), args.Error(1)
 }
 
-func (d *DriverMock) GetByService(serviceID string, limit int) ([]*apigateway.Log, error) {
-	args := d.Called(serviceID, limit)
-
-	if len(d.Calls) == 2 {
-		return nil, nil
-	}
+func (d *DriverMock) Query(query driver.Query, token string) (driver.Page, error) {
+	args := d.Called(query, token)
 
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-
-	return args.Get(0).([]*apigateway.Log), nil
+	return args.Get(0).(driver.Page), args.Error(1)
 }
 
-func (d *DriverMock) GetByConsumer(consumerID string, limit int) ([]*apigateway.Log, error) {
-	args := d.Called(consumerID, limit)
-
-	if len(d.Calls) == 2 {
-		return nil, nil
-	}
+// AggregatorDriverMock is a driver that aggregates the latencies itself, like
+// PostgreSQL.
+type AggregatorDriverMock struct {
+	DriverMock
+}
 
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
+func (d *AggregatorDriverMock) SummarizeLatencies(query driver.Query, quantiles []float64) (driver.LatencySummary, error) {
+	args := d.Called(query, quantiles)
 
-	return args.Get(0).([]*apigateway.Log), nil
+	return args.Get(0).(driver.LatencySummary), args.Error(1)
 }
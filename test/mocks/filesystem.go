@@ -1,9 +1,9 @@
 package mock
 
 import (
-	"bufio"
+	"api-gateway-log-parser/pkg/filesystem"
+	"bytes"
 	"io"
-	"os"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -12,57 +12,103 @@ type FileSystemMock struct {
 	mock.Mock
 }
 
-func (f *FileSystemMock) Open(path string) (*os.File, error) {
+func (f *FileSystemMock) Open(path string) (io.ReadCloser, error) {
 	args := f.Called(path)
 	if args.Get(0) == nil {
 		return nil, args.Error(0)
 	}
 
-	file := args.Get(0).(*os.File)
+	file := args.Get(0).(io.ReadCloser)
 
 	return file, nil
 }
 
-func (f *FileSystemMock) GetScanner(file *os.File) *bufio.Scanner {
-	args := f.Called(file)
-
+func (f *FileSystemMock) Resolve(pattern string) ([]string, error) {
+	args := f.Called(pattern)
 	if args.Get(0) == nil {
-		return nil
+		return nil, args.Error(1)
 	}
 
-	return args.Get(0).(*bufio.Scanner)
+	return args.Get(0).([]string), nil
 }
 
-func (f *FileSystemMock) GetLine(scanner *bufio.Scanner) string {
-	args := f.Called(scanner)
-
-	var getLineCalls []mock.Call
-
-	for _, call := range f.Calls {
-		if call.Method == "GetLine" {
-			getLineCalls = append(getLineCalls, call)
-		}
+func (f *FileSystemMock) Create(path string) (filesystem.File, error) {
+	args := f.Called(path)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
 	}
 
-	if len(getLineCalls) == 2 {
-		return ""
-	}
+	return args.Get(0).(filesystem.File), args.Error(1)
+}
 
+func (f *FileSystemMock) OpenWriter(path string, truncate bool) (io.WriteCloser, error) {
+	args := f.Called(path, truncate)
 	if args.Get(0) == nil {
-		return ""
+		return nil, args.Error(1)
 	}
 
-	return args.Get(0).(string)
+	return args.Get(0).(io.WriteCloser), args.Error(1)
 }
 
-func (f *FileSystemMock) Write(path string, data string) error {
+func (f *FileSystemMock) IsDir(path string) bool {
+	args := f.Called(path)
+
+	return args.Bool(0)
+}
+
+func (f *FileSystemMock) Read(path string) (string, error) {
+	args := f.Called(path)
+
+	return args.String(0), args.Error(1)
+}
+
+func (f *FileSystemMock) Replace(path string, data string) error {
 	args := f.Called(path, data)
 
-	if args.Get(0) == nil {
-		return nil
+	return args.Error(0)
+}
+
+func (f *FileSystemMock) Fingerprint(path string) (string, error) {
+	args := f.Called(path)
+
+	return args.String(0), args.Error(1)
+}
+
+// FileMock keeps what is written to it, which is the argument expected by
+// Commit, e.g. file.On("Commit", "service;requests\n").
+type FileMock struct {
+	mock.Mock
+	bytes.Buffer
+	Aborted bool
+	done    bool
+}
+
+func (f *FileMock) Commit() error {
+	args := f.Called(f.String())
+
+	f.done = args.Error(0) == nil
+
+	return args.Error(0)
+}
+
+func (f *FileMock) Abort() error {
+	if !f.done {
+		f.Aborted = true
 	}
 
-	return args.Get(0).(error)
+	return nil
+}
+
+// WriterMock keeps what is written to it until it is closed.
+type WriterMock struct {
+	bytes.Buffer
+	Closed bool
+}
+
+func (w *WriterMock) Close() error {
+	w.Closed = true
+
+	return nil
 }
 
 type ReaderMock struct {